@@ -2,43 +2,53 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	arrofmap "github.com/Veckatimest/uniqipgo/internal/arrofmap"
+	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
 var (
 	logger   = log.Default()
-	file     = flag.String("f", "ip-list.txt", "Input file")
+	file     = flag.String("f", "ip-list.txt", "Input file, - for stdin")
 	cpu_file = flag.String("cpu", "", "CPU profile file")
+	timeout  = flag.Duration("timeout", 0, "Stop after this time and report partial results")
+	onError  util.ErrorPolicy
 )
 
+func init() {
+	flag.Var(&onError, "on-error", "What to do with malformed lines: fail, skip or collect")
+}
+
 const (
 	BATCH_SIZE = 1000
 )
 
-func readToChan(filename string) (chan []string, error) {
-	strCh := make(chan []string)
+// parseResult is partial if asyncParse was cancelled
+type parseResult struct {
+	unique    uint64
+	lines     uint64
+	malformed util.Malformed
+}
 
-	go func() {
-		file, err := os.Open(filename)
-		if err != nil {
-			close(strCh)
-			return
-		}
-		defer file.Close()
+// readToChan cancels ctx with the error if reading fails
+func readToChan(ctx context.Context, reader io.Reader, cancel context.CancelCauseFunc) (chan util.LineBatch, error) {
+	strCh := make(chan util.LineBatch)
 
-		scanner := bufio.NewScanner(file)
+	go func() {
+		scanner := bufio.NewScanner(reader)
 		batch := make([]string, 0, BATCH_SIZE)
 		count := 0
+		var firstLine uint64 = 1
 		for scanner.Scan() {
 			line := scanner.Text()
 
@@ -46,15 +56,21 @@ func readToChan(filename string) (chan []string, error) {
 			count += 1
 
 			if count == BATCH_SIZE {
-				strCh <- batch
+				if !util.SendOrDone(ctx, strCh, util.LineBatch{Lines: batch, FirstLine: firstLine}) {
+					break
+				}
+				firstLine += uint64(count)
 				count = 0
 
 				batch = make([]string, 0, BATCH_SIZE)
 			}
 		}
 
-		if count != 0 {
-			strCh <- batch
+		if err := scanner.Err(); err != nil {
+			cancel(err)
+		}
+		if count != 0 && ctx.Err() == nil {
+			util.SendOrDone(ctx, strCh, util.LineBatch{Lines: batch, FirstLine: firstLine})
 		}
 		fmt.Printf("scanner loop ended\n")
 
@@ -65,64 +81,93 @@ func readToChan(filename string) (chan []string, error) {
 }
 
 func collectIpWorker(
+	ctx context.Context,
 	target *arrofmap.MapStorage,
-	strCh <-chan []string,
-	errorCh chan<- error,
-) uint32 {
-	var addedIps uint32
+	onError util.ErrorPolicy,
+	strCh <-chan util.LineBatch,
+	cancel context.CancelCauseFunc,
+) parseResult {
+	var result parseResult
 	for batch := range strCh {
-		for _, line := range batch {
+		if ctx.Err() != nil {
+			return result
+		}
+
+		for i, line := range batch.Lines {
 			added, err := target.AddIp(line)
 
 			if err != nil {
-				fmt.Printf("failed to parse ip %s", line)
-				errorCh <- err
-				return 0
+				lineNumber := batch.FirstLine + uint64(i)
+				switch onError {
+				case util.ErrorPolicySkip:
+					continue
+				case util.ErrorPolicyCollect:
+					result.malformed.Add(lineNumber, err)
+					continue
+				default:
+					// stops the reader and other workers
+					cancel(fmt.Errorf("line %d: %w", lineNumber, err))
+					return parseResult{}
+				}
 			}
 
-			addedIps += added
+			result.unique += added
 		}
+		result.lines += uint64(len(batch.Lines))
 	}
 
-	return addedIps
+	return result
 }
 
-func asyncParse(filename string, workerCount int) (uint32, error) {
-	strCh, err := readToChan(filename)
+func asyncParse(
+	ctx context.Context,
+	filename string,
+	workerCount int,
+	onError util.ErrorPolicy,
+) (parseResult, error) {
+	reader, err := util.OpenInput(filename)
+	if err != nil {
+		fmt.Printf("Failed to open file %s\n", filename)
+		return parseResult{}, err
+	}
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	strCh, err := readToChan(ctx, reader, cancel)
 
 	if err != nil {
-		fmt.Println("Failed to read file %s", filename)
-		return 0, err
+		fmt.Printf("Failed to read file %s\n", filename)
+		return parseResult{}, err
 	}
 
 	mainRoot := arrofmap.NewArrayOfMap()
 	var wg sync.WaitGroup
-	var totalSum atomic.Uint32
-	errCh := make(chan error, workerCount)
+	var resultMu sync.Mutex
+	var result parseResult
 	wg.Add(workerCount)
 	for i := 0; i < workerCount; i++ {
 		go func() {
-			count := collectIpWorker(mainRoot, strCh, errCh)
-			totalSum.Add(count)
+			workerResult := collectIpWorker(ctx, mainRoot, onError, strCh, cancel)
+
+			resultMu.Lock()
+			result.unique += workerResult.unique
+			result.lines += workerResult.lines
+			result.malformed.Merge(workerResult.malformed)
+			resultMu.Unlock()
 			wg.Done()
 		}()
 	}
 
 	wg.Wait()
 
-	close(errCh)
-
-	haveErrors := false
-	for err := range errCh {
-		haveErrors = true
-
-		logger.Printf("Error in parsing IPs %s", err.Error())
-	}
-	if haveErrors {
-		os.Exit(1)
+	err = context.Cause(ctx)
+	if err != nil && !util.IsCancellation(err) {
+		return parseResult{}, err
 	}
 
-	return totalSum.Load(), nil
+	return result, err
 }
 
 func main() {
@@ -142,17 +187,32 @@ func main() {
 	}
 
 	start := time.Now()
-	var result uint32
+	var result parseResult
 	var err error = nil
+	ctx, stop := util.NotifyContext(context.Background(), *timeout)
+	defer stop()
 	cpuCount := runtime.NumCPU()
 	logger.Println("Using array of maps to concurrently add ips")
 	logger.Printf("system has %d CPUs", cpuCount)
-	result, err = asyncParse(filename, cpuCount*2+1)
+	result, err = asyncParse(ctx, filename, cpuCount*2+1, onError)
 	logger.Printf("took %v\n", time.Since(start))
 
-	if err != nil {
+	if err != nil && !util.IsCancellation(err) {
 		fmt.Printf("Failed to handle ip list with error %s\n", err.Error())
+		os.Exit(1)
 	}
 
-	fmt.Printf("Total count of unique IPs is %d\n", result)
+	if err != nil {
+		fmt.Printf("Stopped early: %s\n", err)
+		fmt.Printf("Handled %d lines, partial count of unique IPs is %d\n", result.lines, result.unique)
+	} else {
+		fmt.Printf("Handled %d lines\n", result.lines)
+		fmt.Printf("Total count of unique IPs is %d\n", result.unique)
+	}
+	if onError == util.ErrorPolicyCollect {
+		util.LogMalformed(logger, result.malformed)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"runtime"
+
+	fanout "github.com/Veckatimest/uniqipgo/internal/fanout"
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+const COMPARE_USAGE = `Usage: fanout compare [flags] A B
+
+A and B are files, globs or directories of IP lists, or sets saved with -save.
+Prints sizes of A, B, their union, intersection, differences and Jaccard similarity.
+`
+
+// runCompare implements "fanout compare" subcommand
+func runCompare(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	flags.Usage = func() {
+		flags.Output().Write([]byte(COMPARE_USAGE))
+		flags.PrintDefaults()
+	}
+	recursive := flags.Bool("r", false, "Read directories recursively")
+	canonical := flags.Bool("canonical", false, "Treat octets with leading zeros as invalid")
+	ranges := flags.Bool("ranges", false, "Accept CIDR 10.0.0.0/8 and dash 1.2.3.4-1.2.3.200 ranges")
+	timeout := flags.Duration("timeout", 0, "Stop after this time")
+	op := flags.String("op", "", "Set to write to -emit: union, intersection or difference (A \\ B)")
+	emit := flags.String("emit", "-", "File for the -op set, - for stdout")
+	cidr := flags.Bool("cidr", false, "Write the -op set as the minimal list of CIDR blocks")
+	var onError util.ErrorPolicy
+	flags.Var(&onError, "on-error", "What to do with malformed lines: fail, skip or collect")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	combine, ok := map[string]func(a, b *iptree.RootLevel) *iptree.RootLevel{
+		"":             nil,
+		"union":        iptree.Union,
+		"intersection": iptree.Intersection,
+		"difference":   iptree.Difference,
+	}[*op]
+	if !ok {
+		logger.Fatalf("Unsupported -op %s", *op)
+	}
+
+	ctx, stop := util.NotifyContext(context.Background(), *timeout)
+	defer stop()
+
+	opts := fanout.Options{CanonicalOnly: *canonical, OnError: onError, Ranges: *ranges}
+	a := countSet(ctx, flags.Arg(0), *recursive, opts)
+	b := countSet(ctx, flags.Arg(1), *recursive, opts)
+
+	overlap := iptree.Compare(a, b)
+	logger.Printf("|A| = %d\n", overlap.A)
+	logger.Printf("|B| = %d\n", overlap.B)
+	logger.Printf("|A ∪ B| = %d\n", overlap.Union)
+	logger.Printf("|A ∩ B| = %d\n", overlap.Intersection)
+	logger.Printf("|A \\ B| = %d\n", overlap.OnlyA)
+	logger.Printf("|B \\ A| = %d\n", overlap.OnlyB)
+	logger.Printf("Jaccard = %.6f\n", overlap.Jaccard())
+
+	if combine != nil {
+		combined := combine(a, b)
+		emitIps(*emit, &exactSet{all: iptree.All(combined), blocks: iptree.Blocks(combined)}, *cidr)
+	}
+}
+
+// countSet loads a saved set or counts IP lists into a new tree,
+// partial sets are useless for comparison, so any error is fatal
+func countSet(ctx context.Context, pattern string, recursive bool, opts fanout.Options) *iptree.RootLevel {
+	root := iptree.NewRoot(runtime.NumCPU())
+	set := treeSet(root)
+
+	filenames, err := util.ExpandInputs([]string{pattern}, recursive)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(filenames) == 1 && isSnapshot(filenames[0]) {
+		loadSet(filenames[0], set)
+		return root
+	}
+
+	opts.Storage = fanout.NewTreeStorage(root)
+	result, _, err := fanout.RunFiles(ctx, filenames, opts, false)
+	if err != nil {
+		logger.Fatalf("Failed to count %s: %s", pattern, err)
+	}
+	if opts.OnError == util.ErrorPolicyCollect {
+		logger.Printf("%s:", pattern)
+		util.LogMalformed(logger, result.Malformed)
+	}
+
+	return root
+}
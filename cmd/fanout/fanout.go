@@ -5,11 +5,18 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"runtime"
 	"runtime/pprof"
 	"time"
 
+	"github.com/Veckatimest/uniqipgo/internal/bitmap"
 	fanout "github.com/Veckatimest/uniqipgo/internal/fanout"
+	"github.com/Veckatimest/uniqipgo/internal/hll"
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/report"
+	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
 const (
@@ -18,10 +25,37 @@ const (
 
 var (
 	logger           = log.Default()
-	file             = flag.String("f", "", "Input file")
+	file             = flag.String("f", "", "Input file, - for stdin. More files, globs and directories can follow flags")
+	recursive        = flag.Bool("r", false, "Read directories recursively")
+	perFile          = flag.Bool("per-file", false, "Print unique count of every file besides the total")
 	profilingEnabled = flag.Bool("profile", false, "Whether to write profiling data")
+	strategy         = flag.String("strategy", "tree", "Storage for counted ips: tree or bitmap")
+	canonical        = flag.Bool("canonical", false, "Treat octets with leading zeros as invalid")
+	timeout          = flag.Duration("timeout", 0, "Stop after this time and report partial results")
+	sections         = flag.Int("sections", 1, "Number of parts of a regular file read in parallel")
+	mmap             = flag.Bool("mmap", false, "Parse a regular file right from memory mapping")
+	ipv6             = flag.Bool("ipv6", false, "Count IPv6 addresses separately instead of treating them as malformed")
+	ranges           = flag.Bool("ranges", false, "Accept CIDR 10.0.0.0/8 and dash 1.2.3.4-1.2.3.200 ranges, with -approx up to a /8")
+	emit             = flag.String("emit", "", "Write sorted unique IPv4 addresses to this file, - for stdout")
+	cidr             = flag.Bool("cidr", false, "Write -emit as the minimal list of CIDR blocks covering the addresses")
+	load             = flag.String("load", "", "Add addresses saved by -save before counting, a missing file is an empty set")
+	save             = flag.String("save", "", "Save all unique IPv4 addresses to this file after counting")
+	top              = flag.Int("top", 0, "Print this number of the most frequent IPv4 addresses with their line counts")
+	cmsWidth         = flag.Int("cms-width", 0, "Find -top with Count-Min sketches of this width per counter instead of exact counts")
+	cmsDepth         = flag.Int("cms-depth", 4, "Depth of Count-Min sketches for -cms-width")
+	subnets          = flag.Int("subnets", 0, "Report unique IPv4 count of every /8, /16 or /24 network")
+	subnetFormat     = flag.String("subnet-format", "text", "Format of -subnets report: text, csv, json or heat")
+	subnetSort       = flag.String("subnet-sort", "count", "Order of -subnets report: count or subnet")
+	subnetOut        = flag.String("subnet-out", "-", "Write -subnets report to this file, - for stdout")
+	approx           = flag.Bool("approx", false, "Estimate the count with HyperLogLog++ instead of -strategy")
+	precision        = flag.Uint("precision", hll.DEFAULT_PRECISION, "HyperLogLog++ precision for -approx, from 4 to 18")
+	onError          util.ErrorPolicy
 )
 
+func init() {
+	flag.Var(&onError, "on-error", "What to do with malformed lines: fail, skip or collect")
+}
+
 func dumpMetric(idx int, metricName string) {
 	metricFileName := fmt.Sprintf("profiles/%s_%s_%d.prof", APP_NAME, metricName, idx)
 	metricWriter, err := os.Create(metricFileName)
@@ -66,6 +100,16 @@ func profile(profilingCtx context.Context) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 
 	baseCtx := context.Background()
@@ -76,13 +120,171 @@ func main() {
 		defer cancelFunc()
 	}
 
-	filename := *file
-	start := time.Now()
-	count, err := fanout.Run(filename)
+	patterns := flag.Args()
+	if *file != "" {
+		patterns = append([]string{*file}, patterns...)
+	}
+	filenames, err := util.ExpandInputs(patterns, *recursive)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if len(filenames) == 0 {
+		logger.Fatal("No input files, use -f or pass them after flags")
+	}
+	start := time.Now()
+
+	opts := fanout.Options{
+		CanonicalOnly:  *canonical,
+		OnError:        onError,
+		ReadSections:   *sections,
+		Mmap:           *mmap,
+		IPv6:           *ipv6,
+		Ranges:         *ranges,
+		TopN:           *top,
+		TopSketchWidth: *cmsWidth,
+		TopSketchDepth: *cmsDepth,
+	}
+	var sketches *hll.Shards
+	// set is nil for -approx
+	var set *exactSet
+	switch {
+	case *approx:
+		if *perFile {
+			logger.Fatal("-per-file is not supported with -approx")
+		}
+		if sketches, err = hll.NewShards(uint8(min(*precision, 255))); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("Using HyperLogLog++ with precision %d to estimate count", *precision)
+		opts.Storage = sketches
+	case *strategy == "tree":
+		logger.Println("Using tree to store ips")
+		root := iptree.NewRoot(runtime.NumCPU())
+		opts.Storage = fanout.NewTreeStorage(root)
+		set = treeSet(root)
+	case *strategy == "bitmap":
+		logger.Println("Using 512 MiB bitmap to store ips")
+		storage := bitmap.New()
+		opts.Storage = storage
+		set = &exactSet{all: storage.All(), blocks: storage.Blocks(), orBlock: storage.OrBlockOptimistic}
+	default:
+		logger.Fatalf("Unsupported strategy %s", *strategy)
+	}
+
+	if (*emit != "" || *load != "" || *save != "" || *subnets != 0) && set == nil {
+		logger.Fatal("-emit, -load, -save and -subnets need exact storage, they are not supported with -approx")
+	}
+	if *subnets != 0 {
+		if err := report.Check(*subnets, *subnetFormat, *subnetSort); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var loaded uint64
+	if *load != "" {
+		loaded = loadSet(*load, set)
+	}
+
+	runCtx, stop := util.NotifyContext(baseCtx, *timeout)
+	defer stop()
+
+	result, fileResults, err := fanout.RunFiles(runCtx, filenames, opts, *perFile)
+	if err != nil && !util.IsCancellation(err) {
+		logger.Fatal(err)
+	}
 
 	logger.Printf("took %v\n", time.Since(start))
-	logger.Printf("Total count of unique IPs is %d\n", count)
+	if (*perFile || len(filenames) > 1) && sketches == nil {
+		logFiles(fileResults, *perFile)
+	}
+	if err != nil {
+		logger.Printf("Stopped early: %s\n", err)
+	}
+	if *load != "" {
+		logger.Printf("%d IPs are new since %s\n", result.Unique, *load)
+		result.Unique += loaded
+	}
+	logCount(result, sketches, err != nil)
+	if *top > 0 {
+		logTop(result.Top, fanout.TopErrorBound(opts, result.Lines))
+	}
+	if onError == util.ErrorPolicyCollect {
+		if len(filenames) == 1 {
+			util.LogMalformed(logger, result.Malformed)
+		} else {
+			for _, fileResult := range fileResults {
+				logger.Printf("%s:", fileResult.Filename)
+				util.LogMalformed(logger, fileResult.Malformed)
+			}
+		}
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if *save != "" {
+		saveSet(*save, set)
+	}
+	if *emit != "" {
+		emitIps(*emit, set, *cidr)
+	}
+	if *subnets != 0 {
+		writeReport(*subnetOut, set, *subnets, *subnetFormat, *subnetSort)
+	}
+}
+
+// logCount prints the estimate of sketches if they are not nil
+func logCount(result fanout.Result, sketches *hll.Shards, partial bool) {
+	kind := "Total"
+	if partial {
+		kind = "Partial"
+	}
+	logger.Printf("Handled %d lines\n", result.Lines)
+
+	if sketches == nil {
+		if *ipv6 {
+			logger.Printf("%s count of unique IPv4 is %d\n", kind, result.Unique)
+			logger.Printf("%s count of unique IPv6 is %d\n", kind, result.UniqueV6)
+		}
+		logger.Printf("%s count of unique IPs is %d\n", kind, result.Unique+result.UniqueV6)
+		return
+	}
+
+	sketch := sketches.Sketch()
+	estimate := sketch.Estimate()
+	if *ipv6 {
+		logger.Printf("%s count of unique IPv6 is %d, it is not included in the estimate\n", kind, result.UniqueV6)
+	}
+	relErr := sketch.RelativeError()
+	logger.Printf(
+		"%s count of unique IPs is approximately %d ± %.0f (standard error %.2f%%)\n",
+		kind, estimate, float64(estimate)*relErr, relErr*100,
+	)
+}
+
+// logTop prints the error bound of sketches if it isn't 0
+func logTop(top []fanout.HitCount, errorBound uint64) {
+	logger.Printf("Top %d IPs by lines:\n", len(top))
+	if errorBound != 0 {
+		logger.Printf("  counts are estimates, they exceed true counts by at most %d with probability %.4f\n", errorBound, 1-math.Exp(-float64(*cmsDepth)))
+	}
+	for i, hit := range top {
+		logger.Printf("  %d. %s %d\n", i+1, util.FormatOctets(hit.Ip), hit.Hits)
+	}
+}
+
+// logFiles prints ips first seen in every file unless perFile is set
+func logFiles(fileResults []fanout.FileResult, perFile bool) {
+	for _, fileResult := range fileResults {
+		if perFile {
+			logger.Printf(
+				"%s: %d lines, %d unique IPv4, %d new unique IPv6\n",
+				fileResult.Filename, fileResult.Lines, fileResult.Unique, fileResult.UniqueV6,
+			)
+		} else {
+			logger.Printf(
+				"%s: %d lines, %d new unique IPv4, %d new unique IPv6\n",
+				fileResult.Filename, fileResult.Lines, fileResult.Unique, fileResult.UniqueV6,
+			)
+		}
+	}
 }
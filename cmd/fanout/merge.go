@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/snapshot"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+const MERGE_USAGE = `Usage: fanout merge [flags] SET...
+
+SET are files, globs or directories of partial sets saved with -save,
+e.g. by runs on different machines. Prints the exact global unique count.
+`
+
+// runMerge implements "fanout merge" subcommand
+func runMerge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	flags.Usage = func() {
+		flags.Output().Write([]byte(MERGE_USAGE))
+		flags.PrintDefaults()
+	}
+	recursive := flags.Bool("r", false, "Read directories recursively")
+	threads := flags.Int("threads", runtime.NumCPU(), "Number of sets loaded in parallel")
+	save := flags.String("save", "", "Save the merged set to this file")
+	emit := flags.String("emit", "", "Write sorted merged set to this file, - for stdout")
+	cidr := flags.Bool("cidr", false, "Write -emit as the minimal list of CIDR blocks")
+	flags.Parse(args)
+
+	filenames, err := util.ExpandInputs(flags.Args(), *recursive)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	root, err := mergeSets(filenames, max(min(*threads, len(filenames)), 1))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("took %v\n", time.Since(start))
+	logger.Printf("Merged %d sets\n", len(filenames))
+	logger.Printf("Total count of unique IPs is %d\n", iptree.Count(root))
+
+	if *save != "" {
+		saveSet(*save, treeSet(root))
+	}
+	if *emit != "" {
+		emitIps(*emit, treeSet(root), *cidr)
+	}
+}
+
+// mergeSets loads sets into a tree per worker and merges these trees,
+// so set files are read and decompressed in parallel
+func mergeSets(filenames []string, threads int) (*iptree.RootLevel, error) {
+	filenameCh := make(chan string)
+	trees := make([]*iptree.RootLevel, threads)
+	errs := make([]error, threads)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer wg.Done()
+
+			root := iptree.NewEmptyRoot()
+			trees[i] = root
+			for filename := range filenameCh {
+				if errs[i] != nil {
+					continue
+				}
+				errs[i] = loadPartial(filename, root)
+			}
+		}()
+	}
+
+	for _, filename := range filenames {
+		filenameCh <- filename
+	}
+	close(filenameCh)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tree := range trees[1:] {
+		iptree.Merge(trees[0], tree)
+	}
+
+	return trees[0], nil
+}
+
+func loadPartial(filename string, root *iptree.RootLevel) error {
+	input, err := util.OpenInput(filename)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	_, err = snapshot.Read(input, func(network uint32, words [4]uint64) uint64 {
+		return iptree.OrBlockOptimistic(root, network, words)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	logger.Printf("Loaded %s\n", filename)
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/report"
+	"github.com/Veckatimest/uniqipgo/internal/snapshot"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// exactSet gives access to addresses of tree or bitmap storage,
+// none of its functions may run concurrently with counting
+type exactSet struct {
+	all     func(yield func([4]uint8) bool)
+	blocks  snapshot.Blocks
+	orBlock func(network uint32, words [4]uint64) uint64
+}
+
+func treeSet(root *iptree.RootLevel) *exactSet {
+	return &exactSet{
+		all:    iptree.All(root),
+		blocks: iptree.Blocks(root),
+		orBlock: func(network uint32, words [4]uint64) uint64 {
+			return iptree.OrBlockOptimistic(root, network, words)
+		},
+	}
+}
+
+// isSnapshot checks the magic of a (possibly compressed) file,
+// errors are left to the caller which opens the file again
+func isSnapshot(filename string) bool {
+	if filename == util.STDIN_NAME {
+		return false
+	}
+	input, err := util.OpenInput(filename)
+	if err != nil {
+		return false
+	}
+	defer input.Close()
+
+	magic := make([]byte, len(snapshot.MAGIC))
+	if _, err := io.ReadFull(input, magic); err != nil {
+		return false
+	}
+
+	return string(magic) == snapshot.MAGIC
+}
+
+// emitIps writes the minimal list of CIDR blocks covering the set
+// instead of addresses if cidr is set
+func emitIps(filename string, set *exactSet, cidr bool) {
+	start := time.Now()
+	output, err := util.CreateOutput(filename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	kind := "IPs"
+	var count uint64
+	if cidr {
+		kind = "CIDR blocks"
+		count, err = util.WriteCidrs(output, set.blocks)
+	} else {
+		count, err = util.WriteIps(output, set.all)
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Fatalf("Failed to write %s to %s: %s", kind, filename, err)
+	}
+	logger.Printf("Wrote %d %s in %v\n", count, kind, time.Since(start))
+}
+
+// loadSet treats a missing file as an empty set, so the first run of
+// a job with the same -load and -save files works too
+func loadSet(filename string, set *exactSet) uint64 {
+	start := time.Now()
+	input, err := util.OpenInput(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Printf("%s doesn't exist, starting from an empty set\n", filename)
+		return 0
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer input.Close()
+
+	count, err := snapshot.Read(input, set.orBlock)
+	if err != nil {
+		logger.Fatalf("Failed to load IPs from %s: %s", filename, err)
+	}
+	logger.Printf("Loaded %d IPs from %s in %v\n", count, filename, time.Since(start))
+
+	return count
+}
+
+// saveSet writes to a temporary file first, so a failed run doesn't
+// break the previous snapshot
+func saveSet(filename string, set *exactSet) {
+	start := time.Now()
+	tmpName := filename + ".tmp"
+	output, err := os.Create(tmpName)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	count, err := snapshot.Write(output, set.blocks)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filename)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		logger.Fatalf("Failed to save IPs to %s: %s", filename, err)
+	}
+	logger.Printf("Saved %d IPs to %s in %v\n", count, filename, time.Since(start))
+}
+
+// writeReport writes unique counts of networks with prefixLen
+func writeReport(filename string, set *exactSet, prefixLen int, format, sortBy string) {
+	subnets, err := report.Subnets(set.blocks, prefixLen)
+	if err == nil {
+		err = report.Sort(subnets, sortBy)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	output, err := util.CreateOutput(filename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	err = report.Write(output, subnets, format)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Fatalf("Failed to write report to %s: %s", filename, err)
+	}
+	logger.Printf("Reported %d /%d networks\n", len(subnets), prefixLen)
+}
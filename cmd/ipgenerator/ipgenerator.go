@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	rand "math/rand/v2"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
 var (
 	count = flag.String("n", "100", "Number of ip-addresses")
-	file  = flag.String("f", "ip-list.txt", "Target file")
+	file  = flag.String("f", "ip-list.txt", "Target file, - for stdout")
+	all   = flag.Bool("all", false, "Write every IPv4 address once instead of random ones, -n is ignored")
 )
 
 func makeIp() string {
@@ -23,8 +29,45 @@ func makeIp() string {
 	return fmt.Sprintf("%d.%d.%d.%d\n", p1, p2, p3, p4)
 }
 
+// generateAllIps writes 2^32 lines, it's used to check that counts don't overflow
+func generateAllIps(filename string) {
+	f, err := util.CreateOutput(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return
+	}
+	defer f.Close()
+
+	writer := bufio.NewWriterSize(f, 1024*1024)
+	defer writer.Flush()
+
+	line := make([]byte, 0, 16)
+	for ip := uint64(0); ip <= math.MaxUint32; ip++ {
+		if ip%(1<<24) == 0 {
+			fmt.Fprintf(os.Stderr, "Writing %d.0.0.0/8\n", ip>>24)
+		}
+
+		line = line[:0]
+		line = strconv.AppendUint(line, ip>>24, 10)
+		line = append(line, '.')
+		line = strconv.AppendUint(line, (ip>>16)&0xff, 10)
+		line = append(line, '.')
+		line = strconv.AppendUint(line, (ip>>8)&0xff, 10)
+		line = append(line, '.')
+		line = strconv.AppendUint(line, ip&0xff, 10)
+		line = append(line, '\n')
+
+		if _, err := writer.Write(line); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return
+		}
+	}
+}
+
 func generateBigIpList(size int, filename string) {
-	f, err := os.Create(filename)
+	f, err := util.CreateOutput(filename)
 	if err != nil {
 		fmt.Println(err)
 
@@ -35,23 +78,28 @@ func generateBigIpList(size int, filename string) {
 	var sb strings.Builder
 	for i := 0; i < size; i++ {
 		if i%1000000 == 0 {
-			fmt.Printf("Writing %d\n", i)
+			fmt.Fprintf(os.Stderr, "Writing %d\n", i)
 		}
 
 		sb.WriteString(makeIp())
 		if i%10000 == 0 {
-			f.WriteString(sb.String())
+			io.WriteString(f, sb.String())
 			sb.Reset()
 		}
 	}
 
-	f.WriteString(sb.String())
+	io.WriteString(f, sb.String())
 }
 
 func main() {
 	flag.Parse()
 	countStr := *count
 	filename := *file
+
+	if *all {
+		generateAllIps(filename)
+		return
+	}
 	countNum, err := strconv.Atoi(countStr)
 
 	if err != nil {
@@ -10,20 +10,21 @@ import (
 	"time"
 
 	naive "github.com/Veckatimest/uniqipgo/internal/naive"
+	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
 var (
 	logger          = log.Default()
 	optimization    = flag.Int("o", 0, "Optimization level from 0 to 3")
-	file            = flag.String("f", "ip-list.txt", "Input file")
+	file            = flag.String("f", "ip-list.txt", "Input file, - for stdin")
 	cpuprofile      = flag.String("cpu", "", "CPU profile target file")
 	readerBatchSize = 2000
 )
 
 type IpBytes [4]uint8
 
-func optimization0(filename string) (uint32, error) {
-	file, err := os.Open(filename)
+func optimization0(filename string) (uint64, error) {
+	file, err := util.OpenInput(filename)
 	if err != nil {
 		return 0, err
 	}
@@ -32,7 +33,7 @@ func optimization0(filename string) (uint32, error) {
 	scanner := bufio.NewScanner(file)
 	stringMap := make(map[string]bool)
 
-	var counter uint32
+	var counter uint64
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -51,8 +52,8 @@ func optimization0(filename string) (uint32, error) {
 	return counter, nil
 }
 
-func optimization1(filename string) (uint32, error) {
-	file, err := os.Open(filename)
+func optimization1(filename string) (uint64, error) {
+	file, err := util.OpenInput(filename)
 	if err != nil {
 		return 0, err
 	}
@@ -61,7 +62,7 @@ func optimization1(filename string) (uint32, error) {
 	scanner := bufio.NewScanner(file)
 	bytesMap := naive.NewMapOfUint()
 
-	var counter uint32
+	var counter uint64
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -83,8 +84,8 @@ func optimization1(filename string) (uint32, error) {
 	return counter, nil
 }
 
-func optimization2(filename string) (uint32, error) {
-	file, err := os.Open(filename)
+func optimization2(filename string) (uint64, error) {
+	file, err := util.OpenInput(filename)
 	if err != nil {
 		return 0, err
 	}
@@ -93,7 +94,7 @@ func optimization2(filename string) (uint32, error) {
 	scanner := bufio.NewScanner(file)
 	bytesMap := naive.NewMapOfBytes()
 
-	var counter uint32
+	var counter uint64
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -134,7 +135,7 @@ func main() {
 
 	start := time.Now()
 	var err error
-	var count uint32
+	var count uint64
 	switch optimization {
 	case 0:
 		{
@@ -1,3 +1,9 @@
 module github.com/Veckatimest/uniqipgo
 
-go 1.21.5
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/klauspost/pgzip v1.2.6
+	github.com/ulikunitz/xz v0.5.15
+)
@@ -18,22 +18,57 @@ type MapStorage struct {
 	children [256]*SafeMap
 }
 
-func (ms *MapStorage) AddIp(ip string) (uint32, error) {
+func (ms *MapStorage) AddIp(ip string) (uint64, error) {
 	ipBytes, err := util.ParseToOctets(ip)
 
 	if err != nil {
 		return 0, err
 	}
 
+	return ms.AddParsedIp(ipBytes), nil
+}
+
+func (ms *MapStorage) AddParsedIp(ipBytes IpBytes) uint64 {
 	idxStore := ms.children[ipBytes[3]]
 	idxStore.Lock()
 	defer idxStore.Unlock()
 	if idxStore.storage[ipBytes] {
-		return 0, nil
+		return 0
 	}
 
 	idxStore.storage[ipBytes] = true
-	return 1, nil
+	return 1
+}
+
+func (ms *MapStorage) Contains(ipBytes IpBytes) bool {
+	idxStore := ms.children[ipBytes[3]]
+	idxStore.Lock()
+	defer idxStore.Unlock()
+
+	return idxStore.storage[ipBytes]
+}
+
+// ContainsMany returns Contains result for every address,
+// it takes plain arrays like ContainsMany of other storages
+func (ms *MapStorage) ContainsMany(ips [][4]byte) []bool {
+	found := make([]bool, len(ips))
+	for i, ip := range ips {
+		found[i] = ms.Contains(ip)
+	}
+
+	return found
+}
+
+// Count sums sizes of all maps
+func (ms *MapStorage) Count() uint64 {
+	var count uint64
+	for _, child := range ms.children {
+		child.Lock()
+		count += uint64(len(child.storage))
+		child.Unlock()
+	}
+
+	return count
 }
 
 func NewArrayOfMap() *MapStorage {
@@ -0,0 +1,199 @@
+package bitmap
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	WORD_SIZE  = 64
+	WORD_COUNT = 1 << (32 - 6) // 2^32 bits in uint64 words, 512 MiB
+)
+
+// Bitmap keeps one bit for every IPv4 address, bits are ordered as numeric
+// values of addresses, so one /24 network takes 4 consecutive words.
+type Bitmap struct {
+	words []uint64
+}
+
+func New() *Bitmap {
+	return &Bitmap{
+		words: make([]uint64, WORD_COUNT),
+	}
+}
+
+func wordAndBit(ip [4]uint8) (int, uint64) {
+	addr := binary.BigEndian.Uint32(ip[:])
+
+	return int(addr / WORD_SIZE), 1 << (addr % WORD_SIZE)
+}
+
+// Add returns 1 if the address is new, it is safe for concurrent use
+func (bm *Bitmap) Add(ip [4]uint8) uint64 {
+	wordIdx, bit := wordAndBit(ip)
+	word := &bm.words[wordIdx]
+
+	for {
+		current := atomic.LoadUint64(word)
+		if current&bit != 0 {
+			return 0
+		}
+
+		if atomic.CompareAndSwapUint64(word, current, current|bit) {
+			return 1
+		}
+	}
+}
+
+// AddOptimistic doesn't use atomics, so the caller has to make sure that
+// no other goroutine writes addresses of the same /24 network
+func (bm *Bitmap) AddOptimistic(ip [4]uint8) uint64 {
+	wordIdx, bit := wordAndBit(ip)
+	current := bm.words[wordIdx]
+
+	if current&bit != 0 {
+		return 0
+	}
+
+	bm.words[wordIdx] = current | bit
+	return 1
+}
+
+// Contains is safe to call concurrently with Add, but not with optimistic adds
+func (bm *Bitmap) Contains(ip [4]uint8) bool {
+	wordIdx, bit := wordAndBit(ip)
+
+	return atomic.LoadUint64(&bm.words[wordIdx])&bit != 0
+}
+
+// ContainsMany returns Contains result for every address
+func (bm *Bitmap) ContainsMany(ips [][4]uint8) []bool {
+	found := make([]bool, len(ips))
+	for i, ip := range ips {
+		found[i] = bm.Contains(ip)
+	}
+
+	return found
+}
+
+// All returns an iterator over added addresses in ascending order,
+// it must not run concurrently with optimistic adds
+func (bm *Bitmap) All() func(yield func([4]uint8) bool) {
+	return func(yield func([4]uint8) bool) {
+		for wordIdx := range bm.words {
+			word := atomic.LoadUint64(&bm.words[wordIdx])
+			for word != 0 {
+				offset := bits.TrailingZeros64(word)
+				word &= word - 1
+
+				var ip [4]uint8
+				binary.BigEndian.PutUint32(ip[:], uint32(wordIdx*WORD_SIZE+offset))
+				if !yield(ip) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Blocks yields words of non-empty /24 networks in ascending order,
+// network is the address >> 8
+func (bm *Bitmap) Blocks() func(yield func(network uint32, words [4]uint64) bool) {
+	return func(yield func(network uint32, words [4]uint64) bool) {
+		for network := 0; network < WORD_COUNT/4; network++ {
+			words := [4]uint64(bm.words[network*4 : network*4+4])
+			if words == [4]uint64{} {
+				continue
+			}
+
+			if !yield(uint32(network), words) {
+				return
+			}
+		}
+	}
+}
+
+// OrBlockOptimistic adds addresses of a /24 network from words yielded
+// by Blocks and returns the number of new ones
+func (bm *Bitmap) OrBlockOptimistic(network uint32, words [4]uint64) uint64 {
+	var added uint64
+	for i, word := range words {
+		current := &bm.words[int(network)*4+i]
+		added += uint64(bits.OnesCount64(word &^ *current))
+		*current |= word
+	}
+
+	return added
+}
+
+// Merge ORs words of other into bm and returns the number of new addresses,
+// neither bitmap may be changed concurrently
+func (bm *Bitmap) Merge(other *Bitmap) uint64 {
+	var added uint64
+	for i, word := range other.words {
+		if word == 0 {
+			continue
+		}
+		added += uint64(bits.OnesCount64(word &^ bm.words[i]))
+		bm.words[i] |= word
+	}
+
+	return added
+}
+
+// AddRangeOptimistic sets bits from first to last including both, whole
+// words at once, and returns the number of new ones. It must not run
+// concurrently with other writes.
+func (bm *Bitmap) AddRangeOptimistic(first, last [4]uint8) uint64 {
+	start, end := binary.BigEndian.Uint32(first[:]), binary.BigEndian.Uint32(last[:])
+	startWord, endWord := int(start/WORD_SIZE), int(end/WORD_SIZE)
+
+	var added uint64
+	for wordIdx := startWord; wordIdx <= endWord; wordIdx++ {
+		mask := ^uint64(0)
+		if wordIdx == startWord {
+			mask &= ^uint64(0) << (start % WORD_SIZE)
+		}
+		if wordIdx == endWord {
+			mask &= ^uint64(0) >> (WORD_SIZE - 1 - end%WORD_SIZE)
+		}
+
+		added += uint64(bits.OnesCount64(mask &^ bm.words[wordIdx]))
+		bm.words[wordIdx] |= mask
+	}
+
+	return added
+}
+
+// Count sums popcounts of all words using goroutine per CPU
+func (bm *Bitmap) Count() uint64 {
+	threads := runtime.NumCPU()
+	partSize := (len(bm.words) + threads - 1) / threads
+
+	var wg sync.WaitGroup
+	var sum atomic.Uint64
+	for start := 0; start < len(bm.words); start += partSize {
+		end := min(start+partSize, len(bm.words))
+
+		wg.Add(1)
+		go func(part []uint64) {
+			defer wg.Done()
+
+			var partSum uint64
+			for _, word := range part {
+				partSum += uint64(bits.OnesCount64(word))
+			}
+			sum.Add(partSum)
+		}(bm.words[start:end])
+	}
+	wg.Wait()
+
+	return sum.Load()
+}
+
+func (bm *Bitmap) Reset() {
+	clear(bm.words)
+}
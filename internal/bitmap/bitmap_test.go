@@ -0,0 +1,53 @@
+package bitmap
+
+import "testing"
+
+func TestAddRangeWholeSpace(t *testing.T) {
+	bm := New()
+
+	added := bm.AddRangeOptimistic([4]uint8{0, 0, 0, 0}, [4]uint8{255, 255, 255, 255})
+	if added != 1<<32 {
+		t.Errorf("AddRangeOptimistic added %d, want %d", added, uint64(1)<<32)
+	}
+	if count := bm.Count(); count != 1<<32 {
+		t.Errorf("Count() = %d, want %d", count, uint64(1)<<32)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	target, other := New(), New()
+	target.AddOptimistic([4]uint8{1, 2, 3, 4})
+	target.AddRangeOptimistic([4]uint8{10, 0, 0, 0}, [4]uint8{10, 0, 0, 127})
+
+	// disjoint
+	other.AddOptimistic([4]uint8{5, 6, 7, 8})
+	other.AddRangeOptimistic([4]uint8{11, 0, 0, 0}, [4]uint8{11, 0, 0, 63})
+	if added := target.Merge(other); added != 65 {
+		t.Errorf("disjoint: Merge added %d, want 65", added)
+	}
+	if count := target.Count(); count != 194 {
+		t.Errorf("disjoint: Count() = %d, want 194", count)
+	}
+
+	// overlapping, within a word and across words
+	other.Reset()
+	other.AddOptimistic([4]uint8{1, 2, 3, 4})
+	other.AddRangeOptimistic([4]uint8{10, 0, 0, 100}, [4]uint8{10, 0, 0, 200})
+	if added := target.Merge(other); added != 73 {
+		t.Errorf("overlapping: Merge added %d, want 73", added)
+	}
+	if count := target.Count(); count != 267 {
+		t.Errorf("overlapping: Count() = %d, want 267", count)
+	}
+	if !target.Contains([4]uint8{10, 0, 0, 200}) || target.Contains([4]uint8{10, 0, 0, 201}) {
+		t.Errorf("overlapping: wrong end of the merged range")
+	}
+
+	// other is not changed, so merging it again adds nothing
+	if added := target.Merge(other); added != 0 {
+		t.Errorf("merged twice: Merge added %d, want 0", added)
+	}
+	if count := other.Count(); count != 102 {
+		t.Errorf("other has %d addresses after Merge, want 102", count)
+	}
+}
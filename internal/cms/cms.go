@@ -0,0 +1,116 @@
+// Package cms implements Count-Min sketch of IPv4 address frequencies and
+// top-K of the most frequent addresses on top of it, both take fixed memory.
+package cms
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	DEFAULT_WIDTH = 1 << 20
+	DEFAULT_DEPTH = 4
+	MAX_DEPTH     = 16
+)
+
+var (
+	ErrSize     = errors.New("sketch width must be positive and depth from 1 to 16")
+	ErrMismatch = errors.New("sketches have different size")
+)
+
+// Sketch estimates counts from above: an estimate exceeds the true count by
+// at most e/width * Total() with probability 1 - e^-depth. Sketches of the
+// same size add up, so they can be merged across shards and runs.
+// Not safe for concurrent use.
+type Sketch struct {
+	width  int
+	depth  int
+	counts []uint64
+	total  uint64
+}
+
+// New rounds width up to a power of two
+func New(width, depth int) (*Sketch, error) {
+	if width <= 0 || width > 1<<40 || depth < 1 || depth > MAX_DEPTH {
+		return nil, ErrSize
+	}
+	width = 1 << bits.Len(uint(width-1))
+
+	return &Sketch{width: width, depth: depth, counts: make([]uint64, width*depth)}, nil
+}
+
+func (s *Sketch) Width() int {
+	return s.width
+}
+
+func (s *Sketch) Depth() int {
+	return s.depth
+}
+
+// Total is the sum of all added counts
+func (s *Sketch) Total() uint64 {
+	return s.total
+}
+
+// ErrorBound is the maximal overestimate with probability 1 - e^-depth
+func (s *Sketch) ErrorBound() uint64 {
+	return uint64(math.Ceil(math.E / float64(s.width) * float64(s.total)))
+}
+
+// cells derive a column for every row from two halves of a 64 bit hash
+func (s *Sketch) cell(row int, hash uint64) int {
+	h1, h2 := hash&0xFFFFFFFF, hash>>32|1
+	column := int((h1 + uint64(row)*h2) & uint64(s.width-1))
+
+	return row*s.width + column
+}
+
+// Add adds n to the count of ip and returns its new estimate
+func (s *Sketch) Add(ip [4]uint8, n uint64) uint64 {
+	hash := hashIp(ip)
+	estimate := uint64(math.MaxUint64)
+	for row := 0; row < s.depth; row++ {
+		cell := s.cell(row, hash)
+		s.counts[cell] += n
+		estimate = min(estimate, s.counts[cell])
+	}
+	s.total += n
+
+	return estimate
+}
+
+func (s *Sketch) Estimate(ip [4]uint8) uint64 {
+	hash := hashIp(ip)
+	estimate := uint64(math.MaxUint64)
+	for row := 0; row < s.depth; row++ {
+		estimate = min(estimate, s.counts[s.cell(row, hash)])
+	}
+
+	return estimate
+}
+
+// Merge adds counts of other, both need the same width and depth
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.width != other.width || s.depth != other.depth {
+		return ErrMismatch
+	}
+
+	for i, count := range other.counts {
+		s.counts[i] += count
+	}
+	s.total += other.total
+
+	return nil
+}
+
+// hashIp uses splitmix64 finalizer like hll.Hash, but with another constant,
+// so that sketches and HyperLogLog don't correlate
+func hashIp(ip [4]uint8) uint64 {
+	z := uint64(ip[0])<<24 | uint64(ip[1])<<16 | uint64(ip[2])<<8 | uint64(ip[3])
+	z += 0x632be59bd9b4e019
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,171 @@
+package cms
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// zipfIps returns a skewed stream of count addresses out of distinct ones
+func zipfIps(seed int64, count int, distinct uint64) [][4]uint8 {
+	rng := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(rng, 1.2, 1, distinct-1)
+	ips := make([][4]uint8, count)
+	for i := range ips {
+		// spread ranks over the address space
+		n := uint32(zipf.Uint64()*2654435761 + 1)
+		ips[i] = [4]uint8{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}
+	}
+
+	return ips
+}
+
+func exactCounts(ips [][4]uint8) map[[4]uint8]uint64 {
+	counts := make(map[[4]uint8]uint64)
+	for _, ip := range ips {
+		counts[ip]++
+	}
+
+	return counts
+}
+
+func exactTop(counts map[[4]uint8]uint64, k int) []Entry {
+	entries := make([]Entry, 0, len(counts))
+	for ip, count := range counts {
+		entries = append(entries, Entry{Ip: ip, Count: count})
+	}
+	slices.SortFunc(entries, compareEntries)
+
+	return entries[:min(k, len(entries))]
+}
+
+func TestEstimateBounds(t *testing.T) {
+	ips := zipfIps(1, 500_000, 100_000)
+	counts := exactCounts(ips)
+
+	sketch, err := New(1<<14, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range ips {
+		sketch.Add(ip, 1)
+	}
+
+	bound := sketch.ErrorBound()
+	var overBound int
+	for ip, count := range counts {
+		estimate := sketch.Estimate(ip)
+		if estimate < count {
+			t.Fatalf("estimate %d of %v is below the true count %d", estimate, ip, count)
+		}
+		if estimate-count > bound {
+			overBound++
+		}
+	}
+
+	// every estimate is within the bound with probability 1 - e^-depth
+	if allowed := math.Exp(-4) * float64(len(counts)); float64(overBound) > allowed {
+		t.Errorf("%d of %d estimates exceed the bound %d, expected at most %.0f", overBound, len(counts), bound, allowed)
+	}
+}
+
+func newTopK(t *testing.T, k int, ips [][4]uint8) *TopK {
+	t.Helper()
+	topK, err := NewTopK(k, 1<<16, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range ips {
+		topK.Add(ip)
+	}
+
+	return topK
+}
+
+func sameIps(a, b []Entry) bool {
+	return slices.EqualFunc(a, b, func(x, y Entry) bool { return x.Ip == y.Ip })
+}
+
+func TestTopKMatchesExact(t *testing.T) {
+	ips := zipfIps(2, 500_000, 100_000)
+	want := exactTop(exactCounts(ips), 20)
+
+	topK := newTopK(t, 20, ips)
+	got := topK.Top()
+	if !sameIps(got, want) {
+		t.Fatalf("top is %v, want %v", got, want)
+	}
+	bound := topK.Sketch().ErrorBound()
+	for i := range got {
+		if got[i].Count < want[i].Count || got[i].Count > want[i].Count+bound {
+			t.Errorf("count of %v is %d, true count %d, bound %d", got[i].Ip, got[i].Count, want[i].Count, bound)
+		}
+	}
+}
+
+func TestTopKMerge(t *testing.T) {
+	ips := zipfIps(3, 500_000, 100_000)
+	whole := newTopK(t, 20, ips)
+
+	merged := newTopK(t, 20, ips[:len(ips)/2])
+	if err := merged.Merge(newTopK(t, 20, ips[len(ips)/2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(merged.Top(), whole.Top()) {
+		t.Errorf("merged top %v, top of the whole stream %v", merged.Top(), whole.Top())
+	}
+	if merged.Sketch().Total() != whole.Sketch().Total() {
+		t.Errorf("merged total %d, want %d", merged.Sketch().Total(), whole.Sketch().Total())
+	}
+
+	other, err := NewTopK(20, 1<<10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.Merge(other); err == nil {
+		t.Errorf("sketches of different width are merged")
+	}
+}
+
+func TestTopKMarshalRoundTrip(t *testing.T) {
+	ips := zipfIps(4, 100_000, 10_000)
+	topK := newTopK(t, 10, ips)
+
+	data, err := topK.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TopK
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(decoded.Top(), topK.Top()) {
+		t.Errorf("decoded top %v, want %v", decoded.Top(), topK.Top())
+	}
+	for _, ip := range ips[:1000] {
+		if decoded.Sketch().Estimate(ip) != topK.Sketch().Estimate(ip) {
+			t.Fatalf("decoded estimate of %v differs", ip)
+		}
+	}
+	again, err := decoded.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("decoded TopK is encoded differently")
+	}
+
+	// decoded TopK keeps counting
+	decoded.Add(ips[0])
+	if decoded.Sketch().Total() != topK.Sketch().Total()+1 {
+		t.Errorf("decoded total %d, want %d", decoded.Sketch().Total(), topK.Sketch().Total()+1)
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)/2]); err == nil {
+		t.Errorf("truncated TopK is accepted")
+	}
+}
@@ -0,0 +1,79 @@
+package cms
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const FORMAT_VERSION = 1
+
+var ErrFormat = errors.New("invalid count-min sketch data")
+
+// MarshalBinary writes version, width and depth as uvarints, total and
+// counts as little endian uint64, then k and candidate addresses
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	s := t.sketch
+	data := []byte{FORMAT_VERSION}
+	data = binary.AppendUvarint(data, uint64(s.width))
+	data = binary.AppendUvarint(data, uint64(s.depth))
+	data = binary.LittleEndian.AppendUint64(data, s.total)
+	for _, count := range s.counts {
+		data = binary.LittleEndian.AppendUint64(data, count)
+	}
+
+	data = binary.AppendUvarint(data, uint64(t.k))
+	data = binary.AppendUvarint(data, uint64(len(t.top.entries)))
+	for _, entry := range t.top.entries {
+		data = append(data, entry.Ip[:]...)
+	}
+
+	return data, nil
+}
+
+func (t *TopK) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != FORMAT_VERSION {
+		return ErrFormat
+	}
+	data = data[1:]
+
+	readUvarint := func() (uint64, bool) {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, false
+		}
+		data = data[n:]
+		return value, true
+	}
+
+	width, okWidth := readUvarint()
+	depth, okDepth := readUvarint()
+	if !okWidth || !okDepth || width == 0 || width&(width-1) != 0 || width > 1<<40 || depth == 0 || depth > MAX_DEPTH {
+		return ErrFormat
+	}
+	if uint64(len(data)) < 8*(1+width*depth) {
+		return ErrFormat
+	}
+
+	sketch := &Sketch{width: int(width), depth: int(depth), counts: make([]uint64, width*depth)}
+	sketch.total = binary.LittleEndian.Uint64(data)
+	data = data[8:]
+	for i := range sketch.counts {
+		sketch.counts[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	data = data[len(sketch.counts)*8:]
+
+	k, okK := readUvarint()
+	count, okCount := readUvarint()
+	if !okK || !okCount || count > k || uint64(len(data)) != count*4 {
+		return ErrFormat
+	}
+
+	result := TopK{k: int(k), sketch: sketch, top: candidates{positions: make(map[[4]uint8]int, k)}}
+	for i := 0; i < int(count); i++ {
+		ip := [4]uint8(data[i*4 : i*4+4])
+		result.offer(Entry{Ip: ip, Count: sketch.Estimate(ip)})
+	}
+	*t = result
+
+	return nil
+}
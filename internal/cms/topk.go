@@ -0,0 +1,128 @@
+package cms
+
+import (
+	"bytes"
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// Entry is an address with its estimated count
+type Entry struct {
+	Ip    [4]uint8
+	Count uint64
+}
+
+// compareEntries orders by count descending, then by address ascending
+func compareEntries(a, b Entry) int {
+	if c := cmp.Compare(b.Count, a.Count); c != 0 {
+		return c
+	}
+
+	return bytes.Compare(a.Ip[:], b.Ip[:])
+}
+
+// candidates is a min-heap which knows positions of its addresses,
+// so estimates of addresses already in top can be updated
+type candidates struct {
+	entries   []Entry
+	positions map[[4]uint8]int
+}
+
+func (c *candidates) Len() int           { return len(c.entries) }
+func (c *candidates) Less(i, j int) bool { return compareEntries(c.entries[i], c.entries[j]) > 0 }
+func (c *candidates) Swap(i, j int) {
+	c.entries[i], c.entries[j] = c.entries[j], c.entries[i]
+	c.positions[c.entries[i].Ip] = i
+	c.positions[c.entries[j].Ip] = j
+}
+func (c *candidates) Push(x any) {
+	entry := x.(Entry)
+	c.positions[entry.Ip] = len(c.entries)
+	c.entries = append(c.entries, entry)
+}
+func (c *candidates) Pop() any {
+	last := c.entries[len(c.entries)-1]
+	c.entries = c.entries[:len(c.entries)-1]
+	delete(c.positions, last.Ip)
+
+	return last
+}
+
+// TopK keeps k addresses with the largest estimates seen so far,
+// it takes memory of the sketch and k entries. Not safe for concurrent use.
+type TopK struct {
+	k      int
+	sketch *Sketch
+	top    candidates
+}
+
+func NewTopK(k, width, depth int) (*TopK, error) {
+	sketch, err := New(width, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TopK{
+		k:      k,
+		sketch: sketch,
+		top:    candidates{positions: make(map[[4]uint8]int, k)},
+	}, nil
+}
+
+func (t *TopK) Sketch() *Sketch {
+	return t.sketch
+}
+
+func (t *TopK) Add(ip [4]uint8) {
+	t.offer(Entry{Ip: ip, Count: t.sketch.Add(ip, 1)})
+}
+
+func (t *TopK) offer(entry Entry) {
+	// estimates only grow, so an address in top can't be below its minimum
+	if t.top.Len() == t.k && (t.k == 0 || entry.Count < t.top.entries[0].Count) {
+		return
+	}
+
+	if pos, ok := t.top.positions[entry.Ip]; ok {
+		t.top.entries[pos].Count = entry.Count
+		heap.Fix(&t.top, pos)
+		return
+	}
+	if t.top.Len() < t.k {
+		heap.Push(&t.top, entry)
+		return
+	}
+	if t.k > 0 && compareEntries(entry, t.top.entries[0]) < 0 {
+		delete(t.top.positions, t.top.entries[0].Ip)
+		t.top.entries[0] = entry
+		t.top.positions[entry.Ip] = 0
+		heap.Fix(&t.top, 0)
+	}
+}
+
+// Top returns entries sorted by count descending
+func (t *TopK) Top() []Entry {
+	top := slices.Clone(t.top.entries)
+	slices.SortFunc(top, compareEntries)
+
+	return top
+}
+
+// Merge adds counts of other, candidates of both are estimated again
+// with the merged sketch. Sketches need the same size.
+func (t *TopK) Merge(other *TopK) error {
+	if err := t.sketch.Merge(other.sketch); err != nil {
+		return err
+	}
+
+	entries := append(slices.Clone(t.top.entries), other.top.entries...)
+	t.top = candidates{positions: make(map[[4]uint8]int, t.k)}
+	for _, entry := range entries {
+		if _, ok := t.top.positions[entry.Ip]; !ok {
+			t.offer(Entry{Ip: entry.Ip, Count: t.sketch.Estimate(entry.Ip)})
+		}
+	}
+
+	return nil
+}
@@ -1,17 +1,32 @@
 package fanout
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
-
-	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
 )
 
-func counter(root *tree.RootLevel, workerCh <-chan [][4]uint8, addrPool *sync.Pool) uint32 {
-	var count uint32
+// counter counts lines of every address in hits if it is not nil
+func counter(
+	ctx context.Context,
+	storage Storage,
+	workerCh <-chan [][4]uint8,
+	addrPool *sync.Pool,
+	hits hitCounter,
+) uint64 {
+	var count uint64
 	for addressBatch := range workerCh {
+		if ctx.Err() != nil {
+			return count
+		}
+
 		for _, address := range addressBatch {
-			count += tree.AddParsedIpOptimistic(root, address)
+			count += storage.AddOptimistic(address)
+		}
+		if hits != nil {
+			for _, address := range addressBatch {
+				hits.Add(address)
+			}
 		}
 		addressBatch = addressBatch[:0]
 		addrPool.Put(addressBatch)
@@ -20,16 +35,25 @@ func counter(root *tree.RootLevel, workerCh <-chan [][4]uint8, addrPool *sync.Po
 	return count
 }
 
-func runCounters(counterChans [](chan [][4]uint8), addrBatchPool *sync.Pool, tc ThreadCounts) (uint32, error) {
+func runCounters(
+	ctx context.Context,
+	storage Storage,
+	counterChans [](chan [][4]uint8),
+	addrBatchPool *sync.Pool,
+	tc ThreadCounts,
+	hits []hitCounter,
+) uint64 {
 	var wg sync.WaitGroup
-	var sum atomic.Uint32
+	var sum atomic.Uint64
 	wg.Add(tc.counterThreads)
 
-	tree := tree.NewRoot(tc.counterThreads)
-
 	for i := 0; i < tc.counterThreads; i++ {
 		go func(idx int) {
-			mapCount := counter(tree, counterChans[idx], addrBatchPool)
+			var counterHits hitCounter
+			if hits != nil {
+				counterHits = hits[idx]
+			}
+			mapCount := counter(ctx, storage, counterChans[idx], addrBatchPool, counterHits)
 
 			sum.Add(mapCount)
 			wg.Done()
@@ -38,5 +62,5 @@ func runCounters(counterChans [](chan [][4]uint8), addrBatchPool *sync.Pool, tc
 
 	wg.Wait()
 
-	return sum.Load(), nil
+	return sum.Load()
 }
@@ -1,8 +1,21 @@
 package fanout
 
-import "sync"
+import (
+	"context"
+	"sync"
+
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// counterIdx picks a counter by the third octet. Tree keeps the last octet in
+// a FirstOctet bitmap, so the whole /24 has to belong to a single counter,
+// otherwise counters would race on the same bitmap.
+func counterIdx(address [4]uint8, counters uint8) uint8 {
+	return address[2] % counters
+}
 
 func routedDispatcher(
+	ctx context.Context,
 	parsedBatchChan <-chan [][4]uint8,
 	workerChans [](chan [][4]uint8),
 	addrPool *sync.Pool,
@@ -17,10 +30,12 @@ func routedDispatcher(
 
 	for addrBatch := range parsedBatchChan {
 		for _, address := range addrBatch {
-			idx := address[3] % uint8Wc
+			idx := counterIdx(address, uint8Wc)
 			parsedBatches[idx] = append(parsedBatches[idx], address)
 			if len(parsedBatches[idx]) == PARSED_BATCH_SIZE {
-				workerChans[idx] <- parsedBatches[idx]
+				if !util.SendOrDone(ctx, workerChans[idx], parsedBatches[idx]) {
+					return
+				}
 
 				parsedBatches[idx] = addrPool.Get().([][4]uint8)
 			}
@@ -32,7 +47,9 @@ func routedDispatcher(
 
 	for i := 0; i < intWc; i++ {
 		if len(parsedBatches[i]) != 0 {
-			workerChans[i] <- parsedBatches[i]
+			if !util.SendOrDone(ctx, workerChans[i], parsedBatches[i]) {
+				return
+			}
 		}
 	}
 }
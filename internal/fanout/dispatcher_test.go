@@ -0,0 +1,41 @@
+package fanout
+
+import "testing"
+
+// Counters add to FirstOctet bitmaps without locking, so every address of
+// a /24 has to go to the same counter.
+func TestCounterIdxKeepsNetworkTogether(t *testing.T) {
+	for counters := uint8(1); counters <= 32; counters++ {
+		for third := 0; third < 256; third++ {
+			network := [4]uint8{10, 20, uint8(third), 0}
+			want := counterIdx(network, counters)
+			if want >= counters {
+				t.Fatalf("%d counters: index %d for %v", counters, want, network)
+			}
+
+			for last := 0; last < 256; last++ {
+				address := network
+				address[3] = uint8(last)
+				if idx := counterIdx(address, counters); idx != want {
+					t.Fatalf("%d counters: %v goes to %d, %v to %d", counters, network, want, address, idx)
+				}
+			}
+		}
+	}
+}
+
+func TestCounterWholeNetworks(t *testing.T) {
+	counter := NewCounter(4)
+	defer counter.Close()
+
+	// last octet first, so neighbouring adds hit the same bitmap
+	for last := 0; last < 256; last++ {
+		for third := 0; third < 256; third++ {
+			counter.Add([4]uint8{10, 0, uint8(third), uint8(last)})
+		}
+	}
+
+	if count := uint64(counter.Count()); count != 1<<16 {
+		t.Errorf("Count = %d, want %d", count, 1<<16)
+	}
+}
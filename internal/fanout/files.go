@@ -0,0 +1,107 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/ipv6set"
+)
+
+// FileResult is Result of a single file, with per file counting
+// Unique is the number of distinct ips in this file alone
+type FileResult struct {
+	Filename string
+	Result
+}
+
+// RunFiles counts unique ips across all files into the single opts.Storage,
+// files are read one by one with RunFile. With perFile every file is also
+// counted into its own tree, otherwise FileResult.Unique is the number of ips
+// first seen in this file. Total Malformed keeps line numbers inside files,
+// use FileResult for file names. FileResult.UniqueV6 is always the number
+// of IPv6 addresses first seen in the file. Top is filled only in the total
+// Result. On error results of read files are returned.
+func RunFiles(ctx context.Context, filenames []string, opts Options, perFile bool) (Result, []FileResult, error) {
+	counterThreads := opts.threadCount().counterThreads
+	if opts.Storage == nil {
+		opts.Storage = NewTreeStorage(tree.NewRoot(counterThreads))
+	}
+	if opts.IPv6 {
+		opts.v6 = ipv6set.New()
+	}
+	if opts.TopN > 0 {
+		hits, err := newHitCounters(counterThreads, opts)
+		if err != nil {
+			return Result{}, nil, err
+		}
+		opts.hits = hits
+	}
+
+	// one tree for all files, since creating its upper levels is slow
+	var fileRoot *tree.RootLevel
+	if perFile {
+		fileRoot = tree.NewRoot(counterThreads)
+	}
+
+	var total Result
+	fileResults := make([]FileResult, 0, len(filenames))
+	for i, filename := range filenames {
+		fileOpts := opts
+		var totalAdded atomic.Uint64
+		if perFile {
+			if i != 0 {
+				tree.Reset(fileRoot)
+			}
+			fileOpts.Storage = &teeStorage{
+				file:       NewTreeStorage(fileRoot),
+				total:      opts.Storage,
+				totalAdded: &totalAdded,
+			}
+		}
+
+		result, err := RunFile(ctx, filename, fileOpts)
+		fileResults = append(fileResults, FileResult{Filename: filename, Result: result})
+
+		if perFile {
+			total.Unique += totalAdded.Load()
+		} else {
+			total.Unique += result.Unique
+		}
+		total.UniqueV6 += result.UniqueV6
+		total.Lines += result.Lines
+		total.Malformed.Merge(result.Malformed)
+
+		if err != nil {
+			total.Top = topHits(opts.hits, opts.TopN)
+			return total, fileResults, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	total.Top = topHits(opts.hits, opts.TopN)
+
+	return total, fileResults, nil
+}
+
+// teeStorage adds ips to both storages, it returns additions to the file
+// storage and counts additions to the total one in totalAdded
+type teeStorage struct {
+	file       Storage
+	total      Storage
+	totalAdded *atomic.Uint64
+}
+
+func (ts *teeStorage) AddOptimistic(ip [4]uint8) uint64 {
+	if ts.total.AddOptimistic(ip) != 0 {
+		ts.totalAdded.Add(1)
+	}
+
+	return ts.file.AddOptimistic(ip)
+}
+
+func (ts *teeStorage) AddRangeOptimistic(first, last [4]uint8) uint64 {
+	r := ipRange{first: first, last: last}
+	ts.totalAdded.Add(addRange(context.Background(), ts.total, r))
+
+	return addRange(context.Background(), ts.file, r)
+}
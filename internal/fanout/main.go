@@ -1,19 +1,26 @@
 package fanout
 
 import (
+	"context"
+	"io"
 	"log"
 	"math"
 	"runtime"
 	"sync"
+
+	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/ipv6set"
+	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
 var logger = log.Default()
 
 const (
 	APP_NAME          = "fanout"
-	RAW_BATCH_SIZE    = 6000
+	CHUNK_SIZE        = 64 * 1024
+	LONG_LINE_PREFIX  = 64              // bytes of a line longer than CHUNK_SIZE kept for its error
+	RAW_BATCH_SIZE    = CHUNK_SIZE / 14 // average length of a line with random ip
 	PARSED_BATCH_SIZE = 2000
-	BYTES_500K        = 500 * 1024
 
 	PARSER_THREADS     = 1
 	DISPATCHER_THREADS = 1
@@ -42,10 +49,88 @@ func getThreadCount() ThreadCounts {
 	}
 }
 
-func Run(filename string) (uint32, error) {
-	stringBatchPool := sync.Pool{
+// Options allow to override thread counts, zero values are replaced with
+// numbers based on CPU count. Storage defaults to a new tree.
+// CanonicalOnly rejects octets with leading zeros. IPv6 enables counting
+// of IPv6 addresses in a separate set, IPv4-mapped ones are counted as IPv4.
+// Ranges accepts CIDR and dash ranges, they are added after other lines.
+// Storages which are not a RangeStorage accept ranges of up to
+// MAX_SLOW_RANGE addresses, larger ones are malformed lines.
+// TopN > 0 counts lines of every IPv4 address to find the most frequent ones,
+// exactly or with Count-Min sketches of TopSketchWidth x TopSketchDepth
+// per counter if TopSketchWidth > 0.
+// ReadSections and Mmap are used by RunFile to read a file in parallel
+// or to parse it right from memory mapping.
+type Options struct {
+	ParserThreads     int
+	DispatcherThreads int
+	CounterThreads    int
+	ReadSections      int
+	Mmap              bool
+	Storage           Storage
+	CanonicalOnly     bool
+	IPv6              bool
+	Ranges            bool
+	TopN              int
+	TopSketchWidth    int
+	TopSketchDepth    int
+	OnError           util.ErrorPolicy
+
+	// v6 and hits are shared by runs of RunFiles, new ones are used if they are nil
+	v6   *ipv6set.Set
+	hits []hitCounter
+}
+
+// Result is partial if RunReader returns an error, Lines are lines handled
+// by parsers, but their addresses may have not reached counters yet
+type Result struct {
+	// Unique is the count of IPv4 addresses, UniqueV6 is filled only with Options.IPv6
+	Unique   uint64
+	UniqueV6 uint64
+	Lines    uint64
+	// Malformed is filled only with util.ErrorPolicyCollect
+	Malformed util.Malformed
+	// Top is filled only with Options.TopN, ranges are not counted there
+	Top []HitCount
+}
+
+func (opts Options) threadCount() ThreadCounts {
+	tc := getThreadCount()
+	if opts.ParserThreads > 0 {
+		tc.parserThreads = opts.ParserThreads
+	}
+	if opts.DispatcherThreads > 0 {
+		tc.dispatcherThreads = opts.DispatcherThreads
+	}
+	if opts.CounterThreads > 0 {
+		tc.counterThreads = opts.CounterThreads
+	}
+
+	return tc
+}
+
+// Run counts unique ips in a file, util.STDIN_NAME means standard input
+func Run(filename string) (uint64, error) {
+	result, err := RunFile(context.Background(), filename, Options{})
+
+	return result.Unique, err
+}
+
+// RunReader counts unique ips in a stream of lines. The first error of any stage
+// or cancellation of ctx stops all stages, all goroutines exit before RunReader
+// returns. In this case Result has partial counts and the error is the cause
+// of cancellation, e.g. context.Canceled or context.DeadlineExceeded.
+func RunReader(ctx context.Context, reader io.Reader, opts Options) (Result, error) {
+	return run(ctx, []section{{reader: reader}}, opts)
+}
+
+func run(ctx context.Context, sections []section, opts Options) (Result, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	chunkPool := sync.Pool{
 		New: func() any {
-			return make([]string, 0, RAW_BATCH_SIZE)
+			return make([]byte, CHUNK_SIZE)
 		},
 	}
 	addrBatchPool := sync.Pool{
@@ -54,25 +139,48 @@ func Run(filename string) (uint32, error) {
 		},
 	}
 
-	tc := getThreadCount()
+	tc := opts.threadCount()
 	logger.Printf("Chosen thread count is %+v", tc)
 
+	hits := opts.hits
+	if opts.TopN > 0 && hits == nil {
+		var err error
+		if hits, err = newHitCounters(tc.counterThreads, opts); err != nil {
+			return Result{}, err
+		}
+	}
+
 	counterChannels := make([](chan [][4]uint8), tc.counterThreads)
 	for i := 0; i < tc.counterThreads; i++ {
 		counterChannels[i] = make(chan [][4]uint8, 7)
 	}
 
+	statsCh := make(chan readingStats, 1)
 	go func() {
-		if readError := runReading(
-			filename,
+		statsCh <- runReading(
+			ctx,
+			cancel,
+			sections,
 			counterChannels,
 			tc,
-			&stringBatchPool,
+			opts,
+			&chunkPool,
 			&addrBatchPool,
-		); readError != nil {
-			log.Fatal("Failure during parsing ips, exiting, %s", readError.Error())
-		}
+		)
 	}()
 
-	return runCounters(counterChannels, &addrBatchPool, tc)
+	storage := opts.Storage
+	if storage == nil {
+		storage = NewTreeStorage(tree.NewRoot(tc.counterThreads))
+	}
+
+	unique := runCounters(ctx, storage, counterChannels, &addrBatchPool, tc, hits)
+	stats := <-statsCh
+	unique += addRanges(ctx, storage, stats.ranges)
+	result := Result{Unique: unique, UniqueV6: stats.uniqueV6, Lines: stats.lines, Malformed: stats.malformed}
+	if opts.hits == nil {
+		result.Top = topHits(hits, opts.TopN)
+	}
+
+	return result, context.Cause(ctx)
 }
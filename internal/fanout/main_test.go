@@ -0,0 +1,261 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Veckatimest/uniqipgo/internal/bitmap"
+	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+func TestRunReaderWholeSpace(t *testing.T) {
+	opts := Options{Ranges: true, Storage: bitmap.New()}
+
+	result, err := RunReader(context.Background(), strings.NewReader("0.0.0.0/0\n1.2.3.4\n"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unique != 1<<32 {
+		t.Errorf("Unique = %d, want %d", result.Unique, uint64(1)<<32)
+	}
+}
+
+func TestRunReaderLongLines(t *testing.T) {
+	junk := strings.Repeat("x", CHUNK_SIZE+10000)
+	input := "1.2.3.4\n" + junk + "\n5.6.7.8\n" + strings.Repeat("y", 3*CHUNK_SIZE) + "\n9.9.9.9\n" + junk
+
+	for _, policy := range []util.ErrorPolicy{util.ErrorPolicySkip, util.ErrorPolicyCollect} {
+		result, err := RunReader(context.Background(), strings.NewReader(input), Options{OnError: policy})
+		if err != nil {
+			t.Fatalf("%s: %v", policy, err)
+		}
+		if result.Unique != 3 || result.Lines != 6 {
+			t.Errorf("%s: got %d unique of %d lines, want 3 of 6", policy, result.Unique, result.Lines)
+		}
+		if policy == util.ErrorPolicyCollect && result.Malformed.Count != 3 {
+			t.Errorf("collect: got %d malformed lines, want 3", result.Malformed.Count)
+		}
+	}
+
+	_, err := RunReader(context.Background(), strings.NewReader(input), Options{OnError: util.ErrorPolicyFail})
+	var parseErr *util.ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("fail: got %v, want a parse error", err)
+	}
+}
+
+// checkGoroutines fails if goroutines started after before was taken are still running
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines left, %d before the run", runtime.NumGoroutine(), before)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// failingReader returns err after data is read
+type failingReader struct {
+	data *strings.Reader
+	err  error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, _ := r.data.Read(p)
+	if n == 0 {
+		return 0, r.err
+	}
+
+	return n, nil
+}
+
+func TestRunReaderReadError(t *testing.T) {
+	errDisk := errors.New("disk is on fire")
+	before := runtime.NumGoroutine()
+
+	reader := failingReader{data: strings.NewReader(randomIps(100000, 0)), err: errDisk}
+	_, err := RunReader(context.Background(), reader, Options{})
+	if !errors.Is(err, errDisk) {
+		t.Errorf("got %v, want %v", err, errDisk)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRunReaderErrorPolicies(t *testing.T) {
+	input := "1.2.3.4\n1.2.3.4\nbad\n5.6.7.8\n1.2.3\n9.9.9.9\n"
+
+	before := runtime.NumGoroutine()
+	_, err := RunReader(context.Background(), strings.NewReader(input), Options{OnError: util.ErrorPolicyFail})
+	var parseErr *util.ParseError
+	if !errors.As(err, &parseErr) || !strings.HasPrefix(err.Error(), "line 3: ") {
+		t.Errorf("fail: got %v, want a parse error of line 3", err)
+	}
+	checkGoroutines(t, before)
+
+	result, err := RunReader(context.Background(), strings.NewReader(input), Options{OnError: util.ErrorPolicySkip})
+	if err != nil {
+		t.Fatalf("skip: %v", err)
+	}
+	if result.Unique != 3 || result.Lines != 6 || result.Malformed.Count != 0 {
+		t.Errorf("skip: %+v, want 3 unique of 6 lines and nothing collected", result)
+	}
+
+	result, err = RunReader(context.Background(), strings.NewReader(input), Options{OnError: util.ErrorPolicyCollect})
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if result.Unique != 3 || result.Lines != 6 {
+		t.Errorf("collect: %d unique of %d lines, want 3 of 6", result.Unique, result.Lines)
+	}
+	sample := result.Malformed.Sample
+	if result.Malformed.Count != 2 || len(sample) != 2 || sample[0].Line != 3 || sample[1].Line != 5 {
+		t.Errorf("collect: malformed %+v, want lines 3 and 5", result.Malformed)
+	}
+}
+
+// endlessReader repeats lines and calls cancel after cancelAfter reads
+type endlessReader struct {
+	lines       string
+	pos         int
+	reads       int
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == r.cancelAfter {
+		r.cancel()
+	}
+
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.lines[r.pos:])
+		n += copied
+		r.pos = (r.pos + copied) % len(r.lines)
+	}
+
+	return n, nil
+}
+
+func TestRunReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	before := runtime.NumGoroutine()
+
+	result, err := RunReader(ctx, strings.NewReader(randomIps(100000, 0)), Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if result.Unique > result.Lines || result.Lines > 100000 {
+		t.Errorf("got %d unique of %d lines", result.Unique, result.Lines)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRunReaderCancelMidRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	before := runtime.NumGoroutine()
+
+	// 1000 distinct addresses, so the count of a partial run is known
+	reader := &endlessReader{lines: randomIps(1000, 0), cancelAfter: 100, cancel: cancel}
+	result, err := RunReader(ctx, reader, Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if result.Lines == 0 || result.Unique == 0 || result.Unique > 1000 {
+		t.Errorf("got %d unique of %d lines, want a partial count of the first lines", result.Unique, result.Lines)
+	}
+	checkGoroutines(t, before)
+}
+
+func TestRunReaderIPv6(t *testing.T) {
+	input := "1.2.3.4\n::1\n2001:db8::1\n::ffff:1.2.3.4\n::ffff:5.6.7.8\n" +
+		"fe80::1%eth0\nfe80::1\n2001:DB8::1\n::\n1.2.3.4\n2001:db8::zz\n"
+
+	result, err := RunReader(context.Background(), strings.NewReader(input), Options{IPv6: true, OnError: util.ErrorPolicyCollect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unique != 2 || result.UniqueV6 != 4 || result.Lines != 11 {
+		t.Errorf("got %d IPv4 and %d IPv6 unique of %d lines, want 2 and 4 of 11",
+			result.Unique, result.UniqueV6, result.Lines)
+	}
+	if result.Malformed.Count != 1 || result.Malformed.Sample[0].Line != 11 {
+		t.Errorf("got malformed %+v, want line 11", result.Malformed)
+	}
+
+	result, err = RunReader(context.Background(), strings.NewReader(input), Options{OnError: util.ErrorPolicyCollect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unique != 1 || result.UniqueV6 != 0 || result.Malformed.Count != 9 {
+		t.Errorf("without IPv6: got %d IPv4, %d IPv6 unique and %d malformed, want 1, 0 and 9",
+			result.Unique, result.UniqueV6, result.Malformed.Count)
+	}
+}
+
+// countingStorage has no range path, every address it gets is new
+type countingStorage struct {
+	adds uint64
+}
+
+func (cs *countingStorage) AddOptimistic(ip [4]uint8) uint64 {
+	cs.adds++
+
+	return 1
+}
+
+func TestRunReaderSlowRanges(t *testing.T) {
+	input := "1.2.3.4\n10.0.0.0/8\n10.0.0.0/7\n0.0.0.0-255.255.255.255\n1.2.3.4-1.2.3.5\n"
+
+	storage := &countingStorage{}
+	opts := Options{Ranges: true, Storage: storage, CounterThreads: 1, OnError: util.ErrorPolicyCollect}
+	result, err := RunReader(context.Background(), strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(1 + MAX_SLOW_RANGE + 2); result.Unique != want || storage.adds != want {
+		t.Errorf("got %d unique of %d adds, want %d", result.Unique, storage.adds, want)
+	}
+	malformed := result.Malformed
+	if malformed.Count != 2 || malformed.Sample[0].Line != 3 || !errors.Is(malformed.Sample[0].Err, util.ErrRangeSize) {
+		t.Errorf("got malformed %+v, want lines 3 and 4 too large", malformed)
+	}
+
+	// storages with a range path take any range
+	result, err = RunReader(context.Background(), strings.NewReader(input), Options{Ranges: true, Storage: bitmap.New()})
+	if err != nil || result.Unique != 1<<32 {
+		t.Errorf("bitmap: got %d unique (%v), want %d", result.Unique, err, uint64(1)<<32)
+	}
+}
+
+func TestRangeLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage Storage
+		want    uint64
+	}{
+		{"default tree", nil, 0},
+		{"tree", NewTreeStorage(tree.NewEmptyRoot()), 0},
+		{"bitmap", bitmap.New(), 0},
+		{"no range path", &countingStorage{}, MAX_SLOW_RANGE},
+		{"tee of trees", &teeStorage{file: NewTreeStorage(tree.NewEmptyRoot()), total: bitmap.New()}, 0},
+		{"tee with slow total", &teeStorage{file: NewTreeStorage(tree.NewEmptyRoot()), total: &countingStorage{}}, MAX_SLOW_RANGE},
+	}
+
+	for _, tc := range tests {
+		if got := rangeLimit(tc.storage); got != tc.want {
+			t.Errorf("%s: rangeLimit = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package fanout
+
+import (
+	"errors"
+	"os"
+)
+
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func unmapFile(data []byte) error {
+	return errors.ErrUnsupported
+}
+
+const mmapSupported = false
@@ -1,106 +1,414 @@
 package fanout
 
 import (
-	"bufio"
-	"os"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
 	"sync"
 
+	"github.com/Veckatimest/uniqipgo/internal/ipv6set"
 	"github.com/Veckatimest/uniqipgo/internal/util"
 )
 
+// section is a part of the input read by its own goroutine,
+// offset is the position of its first byte in the input.
+// Mapped sections have data instead of reader.
+type section struct {
+	reader io.Reader
+	data   []byte
+	offset int64
+}
+
+// chunk is a block of whole lines, firstLine is 1-based number of its first
+// line in the section. Chunks of mapped sections don't come from chunkPool.
+type chunk struct {
+	data      []byte
+	pooled    bool
+	section   int
+	firstLine uint64
+}
+
+// readToChan reads the section in CHUNK_SIZE blocks cut after the last newline,
+// the tail is moved to the next block. Parsers work right on these blocks,
+// so no string is allocated per line. It returns number of lines read.
 func readToChan(
-	filename string,
-	strCh chan<- []string,
-	strBatchPool *sync.Pool,
-) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		close(strCh)
-		return err
+	ctx context.Context,
+	reader io.Reader,
+	sectionIdx int,
+	chunkCh chan<- chunk,
+	chunkPool *sync.Pool,
+) (uint64, error) {
+	chunkData := chunkPool.Get().([]byte)
+	filled := 0
+	var lineNumber uint64 = 1
+	for {
+		n, err := io.ReadFull(reader, chunkData[filled:])
+		filled += n
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			chunkPool.Put(chunkData)
+			return lineNumber - 1, err
+		}
+
+		lastNewline := bytes.LastIndexByte(chunkData, '\n')
+		if lastNewline == -1 {
+			long := cutLongLine(chunkPool.Get().([]byte), chunkData)
+			if !util.SendOrDone(ctx, chunkCh, chunk{data: long, pooled: true, section: sectionIdx, firstLine: lineNumber}) {
+				chunkPool.Put(long[:cap(long)])
+				chunkPool.Put(chunkData)
+				return lineNumber - 1, ctx.Err()
+			}
+			lineNumber++
+
+			filled, err = skipLine(reader, chunkData)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				chunkPool.Put(chunkData)
+				return lineNumber - 1, err
+			}
+			continue
+		}
+
+		next := chunkPool.Get().([]byte)
+		filled = copy(next, chunkData[lastNewline+1:])
+		lines := chunkData[:lastNewline+1]
+		// parsers return chunks to the pool, so lines are counted before sending
+		lineCount := uint64(bytes.Count(lines, []byte{'\n'}))
+		if !util.SendOrDone(ctx, chunkCh, chunk{data: lines, pooled: true, section: sectionIdx, firstLine: lineNumber}) {
+			chunkPool.Put(chunkData)
+			chunkPool.Put(next)
+			return lineNumber - 1, ctx.Err()
+		}
+		lineNumber += lineCount
+
+		chunkData = next
+	}
+
+	if filled == 0 {
+		chunkPool.Put(chunkData)
+	} else {
+		lines := chunkData[:filled]
+		lineCount := uint64(bytes.Count(lines, []byte{'\n'}))
+		if lines[len(lines)-1] != '\n' {
+			lineCount++
+		}
+		if !util.SendOrDone(ctx, chunkCh, chunk{data: lines, pooled: true, section: sectionIdx, firstLine: lineNumber}) {
+			chunkPool.Put(chunkData)
+			return lineNumber - 1, ctx.Err()
+		}
+		lineNumber += lineCount
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	buffer := make([]byte, BYTES_500K)
-	scanner.Buffer(buffer, BYTES_500K)
-	var batch []string = strBatchPool.Get().([]string)
-	count := 0
-	for scanner.Scan() {
-		line := scanner.Text()
+	return lineNumber - 1, nil
+}
+
+// cutLongLine copies the beginning of a line longer than a chunk to dst.
+// Such a line can't be an address, parsers get its beginning to report it
+// as malformed and the rest is skipped.
+func cutLongLine(dst []byte, line []byte) []byte {
+	n := copy(dst[:LONG_LINE_PREFIX], line)
+	n += copy(dst[n:], "...\n")
+
+	return dst[:n]
+}
+
+// skipLine reads until the end of the current line, bytes after the newline
+// are moved to the beginning of buf. It returns io.EOF if the input ended.
+func skipLine(reader io.Reader, buf []byte) (int, error) {
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if idx := bytes.IndexByte(buf[:n], '\n'); idx != -1 {
+			filled := copy(buf, buf[idx+1:n])
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+
+			return filled, err
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
 
-		batch = append(batch, line)
-		count += 1
+// sliceToChan is readToChan for mapped sections, chunks are slices of data,
+// so nothing is copied except beginnings of long lines
+func sliceToChan(
+	ctx context.Context,
+	data []byte,
+	sectionIdx int,
+	chunkCh chan<- chunk,
+) (uint64, error) {
+	var lineNumber uint64 = 1
+	for len(data) != 0 {
+		end := len(data)
+		if end > CHUNK_SIZE {
+			end = bytes.LastIndexByte(data[:CHUNK_SIZE], '\n') + 1
+		}
+		if end == 0 {
+			long := cutLongLine(make([]byte, LONG_LINE_PREFIX+4), data)
+			if !util.SendOrDone(ctx, chunkCh, chunk{data: long, section: sectionIdx, firstLine: lineNumber}) {
+				return lineNumber - 1, ctx.Err()
+			}
+			lineNumber++
 
-		if count == RAW_BATCH_SIZE {
-			strCh <- batch
-			count = 0
+			end = bytes.IndexByte(data, '\n') + 1
+			if end == 0 {
+				end = len(data)
+			}
+			data = data[end:]
+			continue
+		}
 
-			batch = strBatchPool.Get().([]string)
+		lines := data[:end]
+		if !util.SendOrDone(ctx, chunkCh, chunk{data: lines, section: sectionIdx, firstLine: lineNumber}) {
+			return lineNumber - 1, ctx.Err()
+		}
+		lineNumber += uint64(bytes.Count(lines, []byte{'\n'}))
+		if lines[len(lines)-1] != '\n' {
+			lineNumber++
 		}
+
+		data = data[end:]
+	}
+
+	return lineNumber - 1, nil
+}
+
+// nextLine cuts the first line off the chunk, dropping trailing \r like bufio.ScanLines
+func nextLine(chunk []byte) (line []byte, rest []byte) {
+	lineEnd := bytes.IndexByte(chunk, '\n')
+	if lineEnd == -1 {
+		line, rest = chunk, nil
+	} else {
+		line, rest = chunk[:lineEnd], chunk[lineEnd+1:]
 	}
 
-	if count != 0 {
-		strCh <- batch
+	if len(line) != 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
 	}
-	logger.Printf("scanner loop ended\n")
 
-	return nil
+	return line, rest
+}
+
+type readingStats struct {
+	lines     uint64
+	uniqueV6  uint64
+	ranges    []ipRange
+	malformed util.Malformed
+}
+
+// parserStats keep malformed lines per section, since line numbers
+// are known only inside a section until all sections are read
+type parserStats struct {
+	lines     uint64
+	uniqueV6  uint64
+	ranges    []ipRange
+	malformed []util.Malformed
 }
 
+// ipRange includes both ends
+type ipRange struct {
+	first [4]uint8
+	last  [4]uint8
+}
+
+// lineParser tries IPv6 only for lines with a colon if v6 is not nil and
+// ranges only for lines with a slash or a dash if ranges is set.
+// Ranges of more than maxRange addresses are malformed unless it's 0.
+type lineParser struct {
+	parse    func([]byte) ([4]uint8, error)
+	v6       *ipv6set.Set
+	ranges   bool
+	maxRange uint64
+}
+
+// parseLine returns ok only for a single IPv4 address, IPv6 addresses go
+// straight to v6 and ranges are kept in stats
+func (lp lineParser) parseLine(line []byte, stats *parserStats) (address [4]uint8, ok bool, err error) {
+	address, err = lp.parse(line)
+	if err == nil {
+		return address, true, nil
+	}
+
+	if lp.ranges && bytes.IndexAny(line, "/-") != -1 {
+		first, last, err := util.ParseRangeBytes(line, lp.parse)
+		if err != nil {
+			return address, false, err
+		}
+		size := uint64(binary.BigEndian.Uint32(last[:])) - uint64(binary.BigEndian.Uint32(first[:])) + 1
+		if lp.maxRange != 0 && size > lp.maxRange {
+			return address, false, &util.ParseError{Ip: string(line), Err: util.ErrRangeSize}
+		}
+		stats.ranges = append(stats.ranges, ipRange{first: first, last: last})
+
+		return address, false, nil
+	}
+
+	if lp.v6 != nil && bytes.IndexByte(line, ':') != -1 {
+		addr, err := util.ParseIpv6Bytes(line)
+		if err != nil {
+			return address, false, err
+		}
+		if addr.Is4() {
+			return addr.As4(), true, nil
+		}
+		stats.uniqueV6 += lp.v6.Add(addr.As16())
+
+		return address, false, nil
+	}
+
+	return address, false, err
+}
+
+// batchParser handles malformed lines according to onError,
+// with ErrorPolicyCollect they are returned in parserStats
 func batchParser(
-	strBatchChan <-chan []string,
+	ctx context.Context,
+	lp lineParser,
+	onError util.ErrorPolicy,
+	sections []section,
+	chunkChan <-chan chunk,
 	addrBatchChan chan<- [][4]uint8,
-	stringBatchPool *sync.Pool,
+	chunkPool *sync.Pool,
 	addrBatchPool *sync.Pool,
-) error {
-	for strBatch := range strBatchChan {
+) (parserStats, error) {
+	stats := parserStats{malformed: make([]util.Malformed, len(sections))}
+	for chunk := range chunkChan {
 		parsedBatch := addrBatchPool.Get().([][4]uint8)
-		for _, line := range strBatch {
-			address, err := util.ParseToOctets(line)
+		lineNumber := chunk.firstLine
+		for rest := chunk.data; len(rest) != 0; lineNumber++ {
+			var line []byte
+			line, rest = nextLine(rest)
 
+			address, ok, err := lp.parseLine(line, &stats)
 			if err != nil {
-				return err
+				switch onError {
+				case util.ErrorPolicySkip:
+					continue
+				case util.ErrorPolicyCollect:
+					stats.malformed[chunk.section].Add(lineNumber, err)
+					continue
+				default:
+					return stats, lineError(sections[chunk.section], lineNumber, err)
+				}
 			}
-			parsedBatch = append(parsedBatch, address)
+			if ok {
+				parsedBatch = append(parsedBatch, address)
+			}
+		}
+		stats.lines += lineNumber - chunk.firstLine
+		if chunk.pooled {
+			chunkPool.Put(chunk.data[:cap(chunk.data)])
 		}
-		strBatch = strBatch[:0]
-		stringBatchPool.Put(strBatch)
 
-		addrBatchChan <- parsedBatch
+		if !util.SendOrDone(ctx, addrBatchChan, parsedBatch) {
+			return stats, nil
+		}
 	}
 
-	return nil
+	return stats, nil
 }
 
+// lineError can't use line number in the whole input for sections other than
+// the first one, since previous sections may be not read yet
+func lineError(sec section, lineNumber uint64, err error) error {
+	if sec.offset == 0 {
+		return fmt.Errorf("line %d: %w", lineNumber, err)
+	}
+
+	return fmt.Errorf("line %d after byte %d: %w", lineNumber, sec.offset, err)
+}
+
+// runReading runs readers, parsers and dispatchers and returns when all of them
+// exit. Their errors cancel ctx, so the caller gets them with context.Cause.
+// A Read call that blocks forever delays the return, closing the reader helps.
 func runReading(
-	filename string,
+	ctx context.Context,
+	cancel context.CancelCauseFunc,
+	sections []section,
 	counterChans [](chan [][4]uint8),
 	tc ThreadCounts,
-	stringBatchPool *sync.Pool,
+	opts Options,
+	chunkPool *sync.Pool,
 	addrBatchPool *sync.Pool,
-) error {
-	strBatchCh := make(chan []string, 10)
+) readingStats {
+	chunkCh := make(chan chunk, 10)
 	parsedAddrCh := make(chan [][4]uint8, 10)
-	errCh := make(chan error, 10)
 
-	go func() {
-		if err := readToChan(filename, strBatchCh, stringBatchPool); err != nil {
-			errCh <- err
-		}
+	sectionLines := make([]uint64, len(sections))
+	var readingWg sync.WaitGroup
+	readingWg.Add(len(sections))
+	for i, sec := range sections {
+		go func() {
+			defer readingWg.Done()
+
+			var lines uint64
+			var err error
+			if sec.data != nil {
+				lines, err = sliceToChan(ctx, sec.data, i, chunkCh)
+			} else {
+				lines, err = readToChan(ctx, sec.reader, i, chunkCh, chunkPool)
+			}
+			if err != nil {
+				cancel(err)
+			}
+			sectionLines[i] = lines
+		}()
+	}
 
-		close(strBatchCh)
+	go func() {
+		readingWg.Wait()
+		logger.Printf("reading loop ended\n")
+		close(chunkCh)
 	}()
 
+	parse := util.ParseOctetsBytes
+	if opts.CanonicalOnly {
+		parse = util.ParseOctetsBytesCanonical
+	}
+	lp := lineParser{parse: parse, v6: opts.v6, ranges: opts.Ranges, maxRange: rangeLimit(opts.Storage)}
+	if opts.IPv6 && lp.v6 == nil {
+		lp.v6 = ipv6set.New()
+	}
+
 	var parsingWg sync.WaitGroup
+	var statsMu sync.Mutex
+	var lines, uniqueV6 uint64
+	var ranges []ipRange
+	sectionMalformed := make([]util.Malformed, len(sections))
 
 	parsingWg.Add(tc.parserThreads)
 	for i := 0; i < tc.parserThreads; i++ {
 		go func() {
-			err := batchParser(strBatchCh, parsedAddrCh, stringBatchPool, addrBatchPool)
+			defer parsingWg.Done()
+
+			parserStats, err := batchParser(
+				ctx, lp, opts.OnError, sections, chunkCh, parsedAddrCh, chunkPool, addrBatchPool,
+			)
 			if err != nil {
-				errCh <- err
+				cancel(err)
 			}
-			parsingWg.Done()
+
+			statsMu.Lock()
+			lines += parserStats.lines
+			uniqueV6 += parserStats.uniqueV6
+			ranges = append(ranges, parserStats.ranges...)
+			for i, malformed := range parserStats.malformed {
+				sectionMalformed[i].Merge(malformed)
+			}
+			statsMu.Unlock()
 		}()
 	}
 
@@ -113,7 +421,7 @@ func runReading(
 	dispatchWg.Add(tc.dispatcherThreads)
 	for i := 0; i < tc.dispatcherThreads; i++ {
 		go func() {
-			routedDispatcher(parsedAddrCh, counterChans, addrBatchPool)
+			routedDispatcher(ctx, parsedAddrCh, counterChans, addrBatchPool)
 			dispatchWg.Done()
 		}()
 	}
@@ -124,11 +432,30 @@ func runReading(
 		close(wCh)
 	}
 
-	close(errCh)
+	// after cancellation dispatchers exit early, so other stages have to be waited for
+	parsingWg.Wait()
+	readingWg.Wait()
 
-	err, ok := <-errCh
-	if ok {
-		return err
+	return readingStats{
+		lines:     lines,
+		uniqueV6:  uniqueV6,
+		ranges:    ranges,
+		malformed: mergeSections(sectionMalformed, sectionLines),
 	}
-	return nil
+}
+
+// mergeSections turns line numbers inside sections into line numbers in the whole input
+func mergeSections(sectionMalformed []util.Malformed, sectionLines []uint64) util.Malformed {
+	var malformed util.Malformed
+	var linesBefore uint64
+	for i, secMalformed := range sectionMalformed {
+		for j := range secMalformed.Sample {
+			secMalformed.Sample[j].Line += linesBefore
+		}
+		malformed.Merge(secMalformed)
+
+		linesBefore += sectionLines[i]
+	}
+
+	return malformed
 }
@@ -0,0 +1,132 @@
+package fanout
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// RunFile counts unique ips in a file, util.STDIN_NAME means standard input.
+// Uncompressed regular files are split into opts.ReadSections parts which
+// are read in parallel and with opts.Mmap they are parsed right from memory
+// mapping. Other inputs are read by a single goroutine.
+func RunFile(ctx context.Context, filename string, opts Options) (Result, error) {
+	if filename != util.STDIN_NAME && (opts.ReadSections > 1 || opts.Mmap) {
+		file, err := os.Open(filename)
+		if err != nil {
+			return Result{}, err
+		}
+		defer file.Close()
+
+		sections, unmap, err := splitSections(file, max(opts.ReadSections, 1), opts.Mmap)
+		if err != nil {
+			return Result{}, err
+		}
+		if sections != nil {
+			defer unmap()
+
+			logger.Printf("Reading %s in %d sections, mmap: %v", filename, len(sections), opts.Mmap)
+			return run(ctx, sections, opts)
+		}
+	}
+
+	reader, err := util.OpenInput(filename)
+	if err != nil {
+		return Result{}, err
+	}
+	defer reader.Close()
+
+	return RunReader(ctx, reader, opts)
+}
+
+func noUnmap() error {
+	return nil
+}
+
+// splitSections returns nil if the file can't be read by offsets,
+// i.e. it is not a regular file or it is compressed. Sections are slices
+// of the mapped file with useMmap, unmap must be called after reading.
+func splitSections(file *os.File, count int, useMmap bool) ([]section, func() error, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 {
+		return nil, nil, nil
+	}
+
+	header := make([]byte, 8)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if util.DetectCompression(header[:n]) != util.COMPRESSION_NONE {
+		return nil, nil, nil
+	}
+
+	size := info.Size()
+	starts := []int64{0}
+	for i := 1; i < count; i++ {
+		start, err := lineStartAfter(file, size*int64(i)/int64(count), size)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if start > starts[len(starts)-1] && start < size {
+			starts = append(starts, start)
+		}
+	}
+
+	var mapped []byte
+	unmap := noUnmap
+	if useMmap && mmapSupported {
+		if mapped, err = mapFile(file, size); err != nil {
+			return nil, nil, err
+		}
+		unmap = func() error {
+			return unmapFile(mapped)
+		}
+	}
+
+	sections := make([]section, len(starts))
+	for i, start := range starts {
+		end := size
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		sections[i] = section{offset: start}
+		if mapped != nil {
+			sections[i].data = mapped[start:end]
+		} else {
+			sections[i].reader = io.NewSectionReader(file, start, end-start)
+		}
+	}
+
+	return sections, unmap, nil
+}
+
+// lineStartAfter finds the first line that starts at pos or later
+func lineStartAfter(file *os.File, pos int64, size int64) (int64, error) {
+	if pos == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, CHUNK_SIZE)
+	// a line starts at pos only if the previous byte is a newline
+	for pos--; pos < size; pos += int64(len(buf)) {
+		n, err := file.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if idx := bytes.IndexByte(buf[:n], '\n'); idx != -1 {
+			return pos + int64(idx) + 1, nil
+		}
+	}
+
+	return size, nil
+}
@@ -0,0 +1,165 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Veckatimest/uniqipgo/internal/bitmap"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+func writeTemp(t testing.TB, content string) *os.File {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	return file
+}
+
+func TestLineStartAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		pos     int64
+		want    int64
+	}{
+		{"start of file", "1.1.1.1\n2.2.2.2\n", 0, 0},
+		{"right after newline", "1.1.1.1\n2.2.2.2\n", 8, 8},
+		{"on newline", "1.1.1.1\n2.2.2.2\n", 7, 8},
+		{"inside a line", "1.1.1.1\n2.2.2.2\n", 3, 8},
+		{"inside the last line", "1.1.1.1\n2.2.2.2\n", 10, 16},
+		{"no trailing newline", "1.1.1.1\n2.2.2.2", 10, 15},
+		{"line longer than a chunk", "1\n" + strings.Repeat("x", CHUNK_SIZE*2) + "\n3\n", 5, int64(CHUNK_SIZE*2 + 3)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			file := writeTemp(t, tc.content)
+
+			got, err := lineStartAfter(file, tc.pos, int64(len(tc.content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("lineStartAfter(%d) = %d, want %d", tc.pos, got, tc.want)
+			}
+		})
+	}
+}
+
+// randomIps returns lines of random addresses, every badEvery-th line
+// is malformed if badEvery is not zero
+func randomIps(count int, badEvery int) string {
+	rng := rand.New(rand.NewSource(1))
+	var builder strings.Builder
+	for i := 1; i <= count; i++ {
+		if badEvery != 0 && i%badEvery == 0 {
+			fmt.Fprintf(&builder, "bad line %d\n", i)
+			continue
+		}
+		fmt.Fprintf(&builder, "%d.%d.%d.%d\n", rng.Intn(256), rng.Intn(256), rng.Intn(256), rng.Intn(256))
+	}
+
+	return builder.String()
+}
+
+func sameLine(a, b util.MalformedLine) bool {
+	return a.Line == b.Line && a.Err.Error() == b.Err.Error()
+}
+
+func TestSectionsLineNumbers(t *testing.T) {
+	// 8 malformed lines, so all of them fit into the sample
+	content := randomIps(80000, 10000)
+	file := writeTemp(t, content)
+
+	run := func(sections int, mmap bool) Result {
+		opts := Options{ReadSections: sections, Mmap: mmap, OnError: util.ErrorPolicyCollect}
+		result, err := RunFile(context.Background(), file.Name(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	sequential := run(1, false)
+	if sequential.Malformed.Count != 8 || sequential.Malformed.Sample[0].Line != 10000 {
+		t.Fatalf("sequential run found %+v", sequential.Malformed.Sample)
+	}
+
+	for _, sections := range []int{2, 3, 7} {
+		for _, mmap := range []bool{false, true} {
+			got := run(sections, mmap)
+			if got.Unique != sequential.Unique || got.Lines != sequential.Lines {
+				t.Errorf("%d sections, mmap %t: %d unique of %d lines, want %d of %d",
+					sections, mmap, got.Unique, got.Lines, sequential.Unique, sequential.Lines)
+			}
+			if !slices.EqualFunc(got.Malformed.Sample, sequential.Malformed.Sample, sameLine) {
+				t.Errorf("%d sections, mmap %t: malformed %v, want %v",
+					sections, mmap, got.Malformed.Sample, sequential.Malformed.Sample)
+			}
+		}
+	}
+}
+
+func TestSectionsLongLines(t *testing.T) {
+	junk := strings.Repeat("x", CHUNK_SIZE+10000)
+	file := writeTemp(t, "1.2.3.4\n"+junk+"\n5.6.7.8\n"+strings.Repeat("y", 3*CHUNK_SIZE)+"\n9.9.9.9\n"+junk)
+	prefix := "'" + junk[:LONG_LINE_PREFIX] + "...'"
+
+	for _, sections := range []int{1, 2} {
+		for _, mmap := range []bool{false, true} {
+			opts := Options{ReadSections: sections, Mmap: mmap, OnError: util.ErrorPolicyCollect}
+			result, err := RunFile(context.Background(), file.Name(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Unique != 3 || result.Lines != 6 || result.Malformed.Count != 3 {
+				t.Fatalf("%d sections, mmap %t: %d unique of %d lines, %d malformed, want 3 of 6, 3 malformed",
+					sections, mmap, result.Unique, result.Lines, result.Malformed.Count)
+			}
+			first := result.Malformed.Sample[0]
+			if first.Line != 2 || !strings.Contains(first.Err.Error(), prefix) {
+				t.Errorf("%d sections, mmap %t: first malformed line %d with %d byte error, want line 2 cut to %d bytes",
+					sections, mmap, first.Line, len(first.Err.Error()), LONG_LINE_PREFIX)
+			}
+		}
+	}
+}
+
+func BenchmarkRunFileSections(b *testing.B) {
+	file := writeTemp(b, randomIps(1_000_000, 0))
+	storage := bitmap.New()
+
+	for _, sections := range []int{1, 2, 4, 8} {
+		for _, mmap := range []bool{false, true} {
+			b.Run(fmt.Sprintf("sections=%d/mmap=%t", sections, mmap), func(b *testing.B) {
+				opts := Options{ReadSections: sections, Mmap: mmap, Storage: storage}
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					storage.Reset()
+					b.StartTimer()
+
+					if _, err := RunFile(context.Background(), file.Name(), opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package fanout
+
+import (
+	"context"
+	"encoding/binary"
+
+	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
+)
+
+// Storage is a set of addresses filled by counters. Every counter owns whole
+// /24 networks (see counterIdx), so implementations don't need locks.
+// Both *bitmap.Bitmap and tree (via NewTreeStorage) implement it and RangeStorage.
+type Storage interface {
+	AddOptimistic(ip [4]uint8) uint64
+}
+
+// RangeStorage can add a range of addresses faster than one by one,
+// ranges are added after counters exit, so it needs no locks either
+type RangeStorage interface {
+	AddRangeOptimistic(first, last [4]uint8) uint64
+}
+
+// MAX_SLOW_RANGE is the largest range, a /8, accepted for storages which
+// are not a RangeStorage, since they get every address of it one by one
+const MAX_SLOW_RANGE = 1 << 24
+
+// rangeLimit returns the largest range storage accepts, 0 means any.
+// nil storage is a tree.
+func rangeLimit(storage Storage) uint64 {
+	switch s := storage.(type) {
+	case nil:
+		return 0
+	case *teeStorage:
+		if rangeLimit(s.file) == 0 && rangeLimit(s.total) == 0 {
+			return 0
+		}
+	case RangeStorage:
+		return 0
+	}
+
+	return MAX_SLOW_RANGE
+}
+
+type treeStorage struct {
+	root *tree.RootLevel
+}
+
+func NewTreeStorage(root *tree.RootLevel) Storage {
+	return treeStorage{root: root}
+}
+
+func (ts treeStorage) AddOptimistic(ip [4]uint8) uint64 {
+	return tree.AddParsedIpOptimistic(ts.root, ip)
+}
+
+func (ts treeStorage) AddRangeOptimistic(first, last [4]uint8) uint64 {
+	return tree.AddRangeOptimistic(ts.root, first, last)
+}
+
+func addRanges(ctx context.Context, storage Storage, ranges []ipRange) uint64 {
+	var added uint64
+	for _, r := range ranges {
+		if ctx.Err() != nil {
+			return added
+		}
+		added += addRange(ctx, storage, r)
+	}
+
+	return added
+}
+
+// addRange falls back to adding addresses one by one if storage is not
+// a RangeStorage, it stops early if ctx is cancelled
+func addRange(ctx context.Context, storage Storage, r ipRange) uint64 {
+	if rangeStorage, ok := storage.(RangeStorage); ok {
+		return rangeStorage.AddRangeOptimistic(r.first, r.last)
+	}
+
+	var added uint64
+	start, end := binary.BigEndian.Uint32(r.first[:]), binary.BigEndian.Uint32(r.last[:])
+	for addr := uint64(start); addr <= uint64(end); addr++ {
+		if addr%(1<<16) == 0 && ctx.Err() != nil {
+			return added
+		}
+
+		var ip [4]uint8
+		binary.BigEndian.PutUint32(ip[:], uint32(addr))
+		added += storage.AddOptimistic(ip)
+	}
+
+	return added
+}
@@ -0,0 +1,115 @@
+package fanout
+
+import (
+	"sync"
+
+	tree "github.com/Veckatimest/uniqipgo/internal/iptree"
+)
+
+// Counter runs the counter stage of the pipeline for callers that parse
+// addresses themselves. Add routes addresses the same way routedDispatcher does,
+// so Add must be called from one goroutine at a time.
+type Counter struct {
+	root     *tree.RootLevel
+	chans    [](chan [][4]uint8)
+	batches  [][][4]uint8
+	counts   []uint64
+	addrPool *sync.Pool
+	flushWg  sync.WaitGroup
+	doneWg   sync.WaitGroup
+}
+
+func NewCounter(counterThreads int) *Counter {
+	c := &Counter{
+		root:    tree.NewRoot(counterThreads),
+		chans:   make([](chan [][4]uint8), counterThreads),
+		batches: make([][][4]uint8, counterThreads),
+		counts:  make([]uint64, counterThreads),
+		addrPool: &sync.Pool{
+			New: func() any {
+				return make([][4]uint8, 0, PARSED_BATCH_SIZE)
+			},
+		},
+	}
+
+	c.doneWg.Add(counterThreads)
+	for i := 0; i < counterThreads; i++ {
+		c.chans[i] = make(chan [][4]uint8, 7)
+		c.batches[i] = c.addrPool.Get().([][4]uint8)
+		go c.runWorker(i)
+	}
+
+	return c
+}
+
+// runWorker treats nil batch as a flush request
+func (c *Counter) runWorker(idx int) {
+	defer c.doneWg.Done()
+
+	for addressBatch := range c.chans[idx] {
+		if addressBatch == nil {
+			c.flushWg.Done()
+			continue
+		}
+
+		for _, address := range addressBatch {
+			c.counts[idx] += tree.AddParsedIpOptimistic(c.root, address)
+		}
+		addressBatch = addressBatch[:0]
+		c.addrPool.Put(addressBatch)
+	}
+}
+
+func (c *Counter) Add(address [4]uint8) {
+	idx := counterIdx(address, uint8(len(c.chans)))
+	c.batches[idx] = append(c.batches[idx], address)
+	if len(c.batches[idx]) == PARSED_BATCH_SIZE {
+		c.chans[idx] <- c.batches[idx]
+
+		c.batches[idx] = c.addrPool.Get().([][4]uint8)
+	}
+}
+
+// flush sends pending batches and waits until workers handle them
+func (c *Counter) flush() {
+	c.flushWg.Add(len(c.chans))
+	for i, ch := range c.chans {
+		if len(c.batches[i]) != 0 {
+			ch <- c.batches[i]
+			c.batches[i] = c.addrPool.Get().([][4]uint8)
+		}
+		ch <- nil
+	}
+
+	c.flushWg.Wait()
+}
+
+func (c *Counter) Count() uint64 {
+	c.flush()
+
+	var sum uint64
+	for _, count := range c.counts {
+		sum += count
+	}
+
+	return sum
+}
+
+func (c *Counter) Reset() {
+	c.flush()
+
+	c.root = tree.NewRoot(len(c.chans))
+	for i := range c.counts {
+		c.counts[i] = 0
+	}
+}
+
+// Close stops worker goroutines, Counter can't be used after it
+func (c *Counter) Close() {
+	c.flush()
+
+	for _, ch := range c.chans {
+		close(ch)
+	}
+	c.doneWg.Wait()
+}
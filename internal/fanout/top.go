@@ -0,0 +1,147 @@
+package fanout
+
+import (
+	"bytes"
+	"cmp"
+	"container/heap"
+	"slices"
+
+	"github.com/Veckatimest/uniqipgo/internal/cms"
+)
+
+// HitCount is the number of lines with an address
+type HitCount struct {
+	Ip   [4]uint8
+	Hits uint64
+}
+
+// hitCounter is kept by a counter goroutine for its own /24 networks,
+// so counters of different goroutines have no common addresses
+type hitCounter interface {
+	Add(ip [4]uint8)
+	// Top returns at most n most frequent addresses in any order
+	Top(n int) []HitCount
+}
+
+// newHitCounters returns exact maps unless Options.TopSketchWidth is set
+func newHitCounters(counters int, opts Options) ([]hitCounter, error) {
+	hits := make([]hitCounter, counters)
+	for i := range hits {
+		if opts.TopSketchWidth <= 0 {
+			hits[i] = make(hitMap)
+			continue
+		}
+
+		depth := opts.TopSketchDepth
+		if depth <= 0 {
+			depth = cms.DEFAULT_DEPTH
+		}
+		topK, err := cms.NewTopK(opts.TopN, opts.TopSketchWidth, depth)
+		if err != nil {
+			return nil, err
+		}
+		hits[i] = sketchHits{topK}
+	}
+
+	return hits, nil
+}
+
+type hitMap map[[4]uint8]uint64
+
+func (hm hitMap) Add(ip [4]uint8) {
+	hm[ip]++
+}
+
+func (hm hitMap) Top(n int) []HitCount {
+	top := make(minHeap, 0, n)
+	for ip, count := range hm {
+		pushTop(&top, HitCount{Ip: ip, Hits: count}, n)
+	}
+
+	return top
+}
+
+type sketchHits struct {
+	*cms.TopK
+}
+
+func (sh sketchHits) Top(n int) []HitCount {
+	entries := sh.TopK.Top()
+	top := make([]HitCount, 0, min(n, len(entries)))
+	for _, entry := range entries[:min(n, len(entries))] {
+		top = append(top, HitCount{Ip: entry.Ip, Hits: entry.Count})
+	}
+
+	return top
+}
+
+// TopErrorBound is the maximal overestimate of Result.Top counts with
+// probability 1 - e^-TopSketchDepth, 0 for exact counts
+func TopErrorBound(opts Options, lines uint64) uint64 {
+	if opts.TopSketchWidth <= 0 {
+		return 0
+	}
+	sketch, err := cms.New(opts.TopSketchWidth, 1)
+	if err != nil {
+		return 0
+	}
+	sketch.Add([4]uint8{}, lines)
+
+	return sketch.ErrorBound()
+}
+
+// compareHits orders by hits descending, then by address ascending
+func compareHits(a, b HitCount) int {
+	if c := cmp.Compare(b.Hits, a.Hits); c != 0 {
+		return c
+	}
+
+	return bytes.Compare(a.Ip[:], b.Ip[:])
+}
+
+// minHeap keeps the least frequent of the current top on top
+type minHeap []HitCount
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return compareHits(h[i], h[j]) > 0 }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(HitCount)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return last
+}
+
+// pushTop keeps n most frequent addresses in top
+func pushTop(top *minHeap, hit HitCount, n int) {
+	if top.Len() < n {
+		heap.Push(top, hit)
+		return
+	}
+	if compareHits(hit, (*top)[0]) < 0 {
+		(*top)[0] = hit
+		heap.Fix(top, 0)
+	}
+}
+
+// topHits merges top n of every counter with a heap of size n,
+// since counters have no common addresses
+func topHits(hits []hitCounter, n int) []HitCount {
+	if n <= 0 {
+		return nil
+	}
+
+	merged := make(minHeap, 0, n)
+	for _, shard := range hits {
+		for _, hit := range shard.Top(n) {
+			pushTop(&merged, hit, n)
+		}
+	}
+
+	result := []HitCount(merged)
+	slices.SortFunc(result, compareHits)
+
+	return result
+}
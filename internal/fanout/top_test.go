@@ -0,0 +1,55 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTopMatchesNaiveCounts(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rng, 1.2, 1, 50_000)
+	counts := make(map[[4]uint8]uint64)
+	var builder strings.Builder
+	for i := 0; i < 300_000; i++ {
+		n := uint32(zipf.Uint64()*2654435761 + 1)
+		ip := [4]uint8{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}
+		counts[ip]++
+		fmt.Fprintf(&builder, "%d.%d.%d.%d\n", ip[0], ip[1], ip[2], ip[3])
+	}
+	input := builder.String()
+
+	want := make([]HitCount, 0, len(counts))
+	for ip, hits := range counts {
+		want = append(want, HitCount{Ip: ip, Hits: hits})
+	}
+	slices.SortFunc(want, compareHits)
+	want = want[:10]
+
+	exactOpts := Options{TopN: 10, CounterThreads: 4}
+	sketchOpts := Options{TopN: 10, CounterThreads: 4, TopSketchWidth: 1 << 16, TopSketchDepth: 4}
+	for name, opts := range map[string]Options{"exact": exactOpts, "sketch": sketchOpts} {
+		t.Run(name, func(t *testing.T) {
+			result, err := RunReader(context.Background(), strings.NewReader(input), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Unique != uint64(len(counts)) {
+				t.Errorf("Unique = %d, want %d", result.Unique, len(counts))
+			}
+
+			bound := TopErrorBound(opts, result.Lines)
+			if len(result.Top) != len(want) {
+				t.Fatalf("top has %d addresses, want %d", len(result.Top), len(want))
+			}
+			for i, hit := range result.Top {
+				if hit.Ip != want[i].Ip || hit.Hits < want[i].Hits || hit.Hits > want[i].Hits+bound {
+					t.Errorf("top %d is %v, want %v with error bound %d", i+1, hit, want[i], bound)
+				}
+			}
+		})
+	}
+}
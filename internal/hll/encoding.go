@@ -0,0 +1,96 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	FORMAT_VERSION = 1
+
+	modeSparse = 0
+	modeDense  = 1
+)
+
+var ErrFormat = errors.New("invalid hll sketch data")
+
+// MarshalBinary writes version, precision and mode bytes, followed by
+// registers of a dense sketch or by count and deltas of sparse entries
+// as uvarints
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.dense == nil {
+		s.flushTmp()
+	}
+
+	if s.dense != nil {
+		data := make([]byte, 0, 3+len(s.dense))
+		data = append(data, FORMAT_VERSION, s.precision, modeDense)
+
+		return append(data, s.dense...), nil
+	}
+
+	data := []byte{FORMAT_VERSION, s.precision, modeSparse}
+	data = binary.AppendUvarint(data, uint64(len(s.sparse)))
+	var prev uint32
+	for _, entry := range s.sparse {
+		data = binary.AppendUvarint(data, uint64(entry-prev))
+		prev = entry
+	}
+
+	return data, nil
+}
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != FORMAT_VERSION {
+		return ErrFormat
+	}
+	precision, mode, data := data[1], data[2], data[3:]
+	if precision < MIN_PRECISION || precision > MAX_PRECISION {
+		return ErrPrecision
+	}
+
+	result := Sketch{precision: precision}
+	switch mode {
+	case modeDense:
+		if len(data) != result.registers() {
+			return ErrFormat
+		}
+		result.dense = append([]uint8(nil), data...)
+		for _, rank := range result.dense {
+			if int(rank) > 65-int(precision) {
+				return ErrFormat
+			}
+		}
+	case modeSparse:
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > uint64(len(data)) {
+			return ErrFormat
+		}
+		data = data[n:]
+
+		result.sparse = make([]uint32, 0, count)
+		var prev uint64
+		for i := uint64(0); i < count; i++ {
+			delta, n := binary.Uvarint(data)
+			if n <= 0 || prev+delta > 1<<32-1 {
+				return ErrFormat
+			}
+			data = data[n:]
+			// indexes have to be strictly increasing
+			if i != 0 && (prev+delta)>>RANK_BITS <= prev>>RANK_BITS {
+				return ErrFormat
+			}
+			prev += delta
+			result.sparse = append(result.sparse, uint32(prev))
+		}
+		if len(data) != 0 {
+			return ErrFormat
+		}
+	default:
+		return ErrFormat
+	}
+
+	*s = result
+
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package hll implements HyperLogLog++ sketch for approximate counting of
+// unique IPv4 addresses: 64 bit hash, sparse representation for small
+// cardinalities and Ertl's improved estimator instead of empirical bias tables.
+package hll
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	MIN_PRECISION     = 4
+	MAX_PRECISION     = 18
+	DEFAULT_PRECISION = 14
+	// SPARSE_PRECISION is the precision of sparse entries, 25 bits of index
+	// and 6 bits of rank fit into uint32
+	SPARSE_PRECISION = 25
+)
+
+var ErrPrecision = fmt.Errorf("precision must be in [%d, %d]", MIN_PRECISION, MAX_PRECISION)
+
+var errPrecisionMismatch = errors.New("sketches have different precision")
+
+// Sketch starts sparse and becomes dense, taking 2^precision bytes, when the
+// sparse list grows larger. Not safe for concurrent use.
+type Sketch struct {
+	precision uint8
+	// dense has a register per byte, nil while the sketch is sparse
+	dense []uint8
+	// sparse is sorted by index with one entry per index, see encodeSparse
+	sparse []uint32
+	// tmp keeps unsorted entries until it is full
+	tmp []uint32
+}
+
+func New(precision uint8) (*Sketch, error) {
+	if precision < MIN_PRECISION || precision > MAX_PRECISION {
+		return nil, ErrPrecision
+	}
+
+	return &Sketch{precision: precision}, nil
+}
+
+func (s *Sketch) Precision() uint8 {
+	return s.precision
+}
+
+func (s *Sketch) registers() int {
+	return 1 << s.precision
+}
+
+// RelativeError is the standard error of the estimate, 1.04/sqrt(m)
+func RelativeError(precision uint8) float64 {
+	return 1.04 / math.Sqrt(float64(uint64(1)<<precision))
+}
+
+func (s *Sketch) RelativeError() float64 {
+	return RelativeError(s.precision)
+}
+
+// Hash mixes an address with splitmix64 finalizer, so that sequential
+// addresses get unrelated hashes
+func Hash(ip [4]uint8) uint64 {
+	z := uint64(ip[0])<<24 | uint64(ip[1])<<16 | uint64(ip[2])<<8 | uint64(ip[3])
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
+
+func (s *Sketch) Add(ip [4]uint8) {
+	s.AddHash(Hash(ip))
+}
+
+func (s *Sketch) AddHash(hash uint64) {
+	if s.dense != nil {
+		s.addDense(hash)
+		return
+	}
+
+	s.tmp = append(s.tmp, encodeSparse(hash))
+	if len(s.tmp) >= s.tmpLimit() {
+		s.flushTmp()
+	}
+}
+
+func (s *Sketch) addDense(hash uint64) {
+	idx := hash >> (64 - s.precision)
+	// the sentinel bit limits rank by 64-precision+1
+	rank := uint8(bits.LeadingZeros64(hash<<s.precision|1<<(s.precision-1))) + 1
+	if rank > s.dense[idx] {
+		s.dense[idx] = rank
+	}
+}
+
+func (s *Sketch) tmpLimit() int {
+	return max(s.registers()/16, 16)
+}
+
+// flushTmp merges tmp into sparse and turns the sketch dense when sparse
+// takes more memory than dense registers
+func (s *Sketch) flushTmp() {
+	if len(s.tmp) == 0 {
+		return
+	}
+
+	s.sparse = mergeSparse(s.sparse, sortSparse(s.tmp))
+	s.tmp = s.tmp[:0]
+
+	if len(s.sparse)*4 > s.registers() {
+		s.toDense()
+	}
+}
+
+func (s *Sketch) toDense() {
+	s.dense = make([]uint8, s.registers())
+	for _, entry := range s.sparse {
+		s.addSparseToDense(entry)
+	}
+	for _, entry := range s.tmp {
+		s.addSparseToDense(entry)
+	}
+	s.sparse = nil
+	s.tmp = nil
+}
+
+func (s *Sketch) addSparseToDense(entry uint32) {
+	idx, rank := decodeDense(entry, s.precision)
+	if rank > s.dense[idx] {
+		s.dense[idx] = rank
+	}
+}
+
+// Merge adds addresses of other to the sketch, other is not changed
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.precision != other.precision {
+		return errPrecisionMismatch
+	}
+
+	if other.dense == nil {
+		otherSparse := mergeSparse(other.sparse, sortSparse(append([]uint32(nil), other.tmp...)))
+		if s.dense != nil {
+			for _, entry := range otherSparse {
+				s.addSparseToDense(entry)
+			}
+			return nil
+		}
+
+		s.flushTmp()
+		if s.dense == nil {
+			s.sparse = mergeSparse(s.sparse, otherSparse)
+			if len(s.sparse)*4 > s.registers() {
+				s.toDense()
+			}
+		} else {
+			for _, entry := range otherSparse {
+				s.addSparseToDense(entry)
+			}
+		}
+		return nil
+	}
+
+	if s.dense == nil {
+		s.toDense()
+	}
+	for i, rank := range other.dense {
+		if rank > s.dense[i] {
+			s.dense[i] = rank
+		}
+	}
+
+	return nil
+}
+
+// Estimate uses linear counting over 2^SPARSE_PRECISION registers for
+// sparse sketches, which is almost exact there
+func (s *Sketch) Estimate() uint64 {
+	if s.dense == nil {
+		s.flushTmp()
+	}
+	if s.dense == nil {
+		sparseRegisters := float64(uint64(1) << SPARSE_PRECISION)
+		empty := sparseRegisters - float64(len(s.sparse))
+
+		return uint64(math.Round(sparseRegisters * math.Log(sparseRegisters/empty)))
+	}
+
+	return uint64(math.Round(ertlEstimate(s.dense, s.precision)))
+}
+
+func (s *Sketch) Reset() {
+	s.dense = nil
+	s.sparse = nil
+	s.tmp = nil
+}
+
+// ertlEstimate is the improved raw estimator from "New cardinality estimation
+// algorithms for HyperLogLog sketches" by Otmar Ertl, it is unbiased for
+// small and large cardinalities without switching to linear counting
+func ertlEstimate(registers []uint8, precision uint8) float64 {
+	q := 64 - int(precision)
+	m := float64(len(registers))
+
+	histogram := make([]float64, q+2)
+	for _, rank := range registers {
+		histogram[rank]++
+	}
+
+	z := m * tau(1-histogram[q+1]/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + histogram[k])
+	}
+	z += m * sigma(histogram[0]/m)
+
+	return m * m / (2 * math.Ln2 * z)
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package hll
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+)
+
+// randomIps returns count random addresses, about a tenth of them repeated
+func randomIps(seed int64, count int) [][4]uint8 {
+	rng := rand.New(rand.NewSource(seed))
+	ips := make([][4]uint8, count)
+	for i := range ips {
+		if i > 0 && rng.Intn(10) == 0 {
+			ips[i] = ips[rng.Intn(i)]
+			continue
+		}
+		ips[i] = [4]uint8{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+	}
+
+	return ips
+}
+
+func newSketch(t *testing.T, precision uint8, ips ...[][4]uint8) *Sketch {
+	t.Helper()
+	sketch, err := New(precision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range ips {
+		for _, ip := range part {
+			sketch.Add(ip)
+		}
+	}
+
+	return sketch
+}
+
+func TestEstimateAgainstTree(t *testing.T) {
+	for _, count := range []int{1_000, 100_000, 2_000_000} {
+		ips := randomIps(int64(count), count)
+		root := iptree.NewRoot(0)
+		for _, ip := range ips {
+			iptree.AddParsedIpOptimistic(root, ip)
+		}
+		exact := iptree.Count(root)
+
+		for _, precision := range []uint8{14, 18} {
+			t.Run(fmt.Sprintf("%d/p=%d", count, precision), func(t *testing.T) {
+				estimate := newSketch(t, precision, ips).Estimate()
+
+				relErr := math.Abs(float64(estimate)-float64(exact)) / float64(exact)
+				if relErr > 3*RelativeError(precision) {
+					t.Errorf("estimate %d of %d is off by %.3f%%, 3 standard errors are %.3f%%",
+						estimate, exact, relErr*100, 3*RelativeError(precision)*100)
+				}
+			})
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		dense bool
+	}{
+		{"empty", 0, false},
+		{"sparse", 500, false},
+		{"dense", 100_000, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sketch := newSketch(t, 14, randomIps(1, tc.count))
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isDense := sketch.dense != nil; isDense != tc.dense {
+				t.Fatalf("sketch of %d IPs is dense: %t", tc.count, isDense)
+			}
+
+			var decoded Sketch
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Estimate() != sketch.Estimate() {
+				t.Errorf("decoded estimate %d, want %d", decoded.Estimate(), sketch.Estimate())
+			}
+			again, err := decoded.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("decoded sketch is encoded differently")
+			}
+		})
+	}
+}
+
+func TestUnmarshalCorrupted(t *testing.T) {
+	data, err := newSketch(t, 14, randomIps(1, 500)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Sketch
+	if err := decoded.UnmarshalBinary(data[:len(data)-3]); err == nil {
+		t.Errorf("truncated sketch is accepted")
+	}
+}
+
+func TestMergeMatchesUnion(t *testing.T) {
+	sizes := map[string]int{"sparse": 500, "dense": 100_000}
+	for _, a := range []string{"sparse", "dense"} {
+		for _, b := range []string{"sparse", "dense"} {
+			t.Run(a+"+"+b, func(t *testing.T) {
+				ipsA := randomIps(1, sizes[a])
+				// b shares the first half of a
+				ipsB := append(randomIps(2, sizes[b]), ipsA[:len(ipsA)/2]...)
+
+				merged := newSketch(t, 14, ipsA)
+				if err := merged.Merge(newSketch(t, 14, ipsB)); err != nil {
+					t.Fatal(err)
+				}
+				union := newSketch(t, 14, ipsA, ipsB)
+
+				if merged.Estimate() != union.Estimate() {
+					t.Errorf("merged estimate %d, union estimate %d", merged.Estimate(), union.Estimate())
+				}
+			})
+		}
+	}
+}
+
+func TestMergePrecisionMismatch(t *testing.T) {
+	if err := newSketch(t, 14).Merge(newSketch(t, 12)); err == nil {
+		t.Errorf("sketches of different precision are merged")
+	}
+}
@@ -0,0 +1,38 @@
+package hll
+
+// Shards keep a sketch per third octet, so fanout counters, which own
+// addresses by the third octet, can add to it without locks
+type Shards struct {
+	shards [256]*Sketch
+}
+
+func NewShards(precision uint8) (*Shards, error) {
+	var shards Shards
+	for i := range shards.shards {
+		sketch, err := New(precision)
+		if err != nil {
+			return nil, err
+		}
+		shards.shards[i] = sketch
+	}
+
+	return &shards, nil
+}
+
+// AddOptimistic implements fanout.Storage, it always returns 0,
+// use Sketch().Estimate() after counting
+func (s *Shards) AddOptimistic(ip [4]uint8) uint64 {
+	s.shards[ip[2]].Add(ip)
+
+	return 0
+}
+
+// Sketch merges all shards into a new sketch
+func (s *Shards) Sketch() *Sketch {
+	merged, _ := New(s.shards[0].precision)
+	for _, shard := range s.shards {
+		merged.Merge(shard)
+	}
+
+	return merged
+}
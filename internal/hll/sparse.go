@@ -0,0 +1,75 @@
+package hll
+
+import (
+	"math/bits"
+	"slices"
+)
+
+const (
+	RANK_BITS = 6
+	RANK_MASK = 1<<RANK_BITS - 1
+)
+
+// encodeSparse keeps SPARSE_PRECISION bits of index and rank of the rest
+func encodeSparse(hash uint64) uint32 {
+	idx := uint32(hash >> (64 - SPARSE_PRECISION))
+	rank := uint32(bits.LeadingZeros64(hash<<SPARSE_PRECISION|1<<(SPARSE_PRECISION-1))) + 1
+
+	return idx<<RANK_BITS | rank
+}
+
+// decodeDense returns register index and rank the sparse entry has
+// in a sketch with lower precision
+func decodeDense(entry uint32, precision uint8) (uint32, uint8) {
+	sparseIdx := entry >> RANK_BITS
+	extraBits := SPARSE_PRECISION - precision
+	idx := sparseIdx >> extraBits
+
+	extra := sparseIdx & (1<<extraBits - 1)
+	if extra != 0 {
+		return idx, uint8(bits.LeadingZeros32(extra)-(32-int(extraBits))) + 1
+	}
+
+	return idx, extraBits + uint8(entry&RANK_MASK)
+}
+
+// sortSparse sorts entries in place and keeps the max rank of every index
+func sortSparse(entries []uint32) []uint32 {
+	slices.Sort(entries)
+
+	result := entries[:0]
+	for _, entry := range entries {
+		// entries with the same index are sorted by rank, so the last one wins
+		if len(result) != 0 && result[len(result)-1]>>RANK_BITS == entry>>RANK_BITS {
+			result[len(result)-1] = entry
+		} else {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
+// mergeSparse merges two sorted lists into a new one
+func mergeSparse(a, b []uint32) []uint32 {
+	result := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		aIdx, bIdx := a[i]>>RANK_BITS, b[j]>>RANK_BITS
+		switch {
+		case aIdx < bIdx:
+			result = append(result, a[i])
+			i++
+		case aIdx > bIdx:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, max(a[i], b[j]))
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+
+	return append(result, b[j:]...)
+}
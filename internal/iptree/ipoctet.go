@@ -1,6 +1,7 @@
 package iptree
 
 import (
+	"math/bits"
 	"sync"
 )
 
@@ -30,7 +31,7 @@ func octetsOffsetAndIdx(octetVal uint8) (idx int, newBit uint64) {
 	return idx, newBit
 }
 
-func (fl *FirstOctet) addIp(octetVal uint8) uint32 {
+func (fl *FirstOctet) addIp(octetVal uint8) uint64 {
 	idx, newBit := octetsOffsetAndIdx(octetVal)
 
 	fl.Lock()
@@ -38,7 +39,15 @@ func (fl *FirstOctet) addIp(octetVal uint8) uint32 {
 	return fl.addBitOptimistic(idx, newBit)
 }
 
-func (fl *FirstOctet) addBitOptimistic(idx int, newBit uint64) uint32 {
+func (fl *FirstOctet) contains(octetVal uint8) bool {
+	idx, bit := octetsOffsetAndIdx(octetVal)
+
+	fl.Lock()
+	defer fl.Unlock()
+	return fl.bitmap[idx]&bit != 0
+}
+
+func (fl *FirstOctet) addBitOptimistic(idx int, newBit uint64) uint64 {
 	bitmapSection := fl.bitmap[idx]
 	withBit := bitmapSection | newBit
 
@@ -91,6 +100,14 @@ func (lvl *IpOctet[Child]) GetChild(part uint8) *Child {
 	return element
 }
 
+// LookupChild doesn't create missing children, it returns nil instead
+func (lvl *IpOctet[Child]) LookupChild(part uint8) *Child {
+	lvl.RLock()
+	defer lvl.RUnlock()
+
+	return lvl.children[part]
+}
+
 func (lvl *IpOctet[Child]) GetChildOptimistic(part uint8) *Child {
 	element := lvl.children[part]
 	if element != nil {
@@ -107,3 +124,60 @@ func (lvl *IpOctet[Child]) Populate() {
 		lvl.children[i] = lvl.newChild()
 	}
 }
+
+// fillOptimistic sets bits of last octets from lo to hi including both,
+// it returns the number of new bits
+func (fl *FirstOctet) fillOptimistic(lo, hi uint8) uint64 {
+	var added uint64
+	for idx := range fl.bitmap {
+		wordLo, wordHi := idx*64, idx*64+63
+		from, to := max(int(lo), wordLo), min(int(hi), wordHi)
+		if from > to {
+			continue
+		}
+
+		mask := (^uint64(0) >> (63 - (to - from))) << (from - wordLo)
+		added += uint64(bits.OnesCount64(mask &^ fl.bitmap[idx]))
+		fl.bitmap[idx] |= mask
+	}
+
+	return added
+}
+
+// yieldAll yields addresses of set bits in ascending order, it returns
+// false if yield asked to stop
+func (fl *FirstOctet) yieldAll(prefix [3]uint8, yield func([4]uint8) bool) bool {
+	for idx, word := range fl.bitmap {
+		for word != 0 {
+			offset := bits.TrailingZeros64(word)
+			word &= word - 1
+
+			if !yield([4]uint8{prefix[0], prefix[1], prefix[2], uint8(idx<<getIdxShift + offset)}) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// orOptimistic sets bits of words, which have the layout of bitmap,
+// and returns the number of new bits
+func (fl *FirstOctet) orOptimistic(words [4]uint64) uint64 {
+	var added uint64
+	for idx, word := range words {
+		added += uint64(bits.OnesCount64(word &^ fl.bitmap[idx]))
+		fl.bitmap[idx] |= word
+	}
+
+	return added
+}
+
+func (fl *FirstOctet) count() uint64 {
+	var count uint64
+	for _, word := range fl.bitmap {
+		count += uint64(bits.OnesCount64(word))
+	}
+
+	return count
+}
@@ -1,6 +1,8 @@
 package iptree
 
 import (
+	"encoding/binary"
+	"runtime"
 	"sync"
 
 	"github.com/Veckatimest/uniqipgo/internal/util"
@@ -14,7 +16,12 @@ func childMaker(idxCh <-chan int, root *RootLevel) {
 	}
 }
 
+// NewRoot creates the first two levels with threads goroutines,
+// one per CPU if threads <= 0
 func NewRoot(threads int) *RootLevel {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
 	var rootChildren [256]*ThirdLevel
 
 	root := &RootLevel{
@@ -44,22 +51,48 @@ func NewRoot(threads int) *RootLevel {
 	return root
 }
 
+// NewEmptyRoot creates all levels on demand, so it is cheap for small sets,
+// but unlike NewRoot it allows optimistic adds from a single goroutine only
+func NewEmptyRoot() *RootLevel {
+	return &RootLevel{newChild: FourthsChild}
+}
+
+// Reset drops all addresses but keeps the first two levels created by NewRoot,
+// it is much cheaper than a new root. It must not run concurrently with adds.
+func Reset(target *RootLevel) {
+	for _, lvl3 := range target.children[:] {
+		if lvl3 == nil {
+			continue
+		}
+		for _, lvl2 := range lvl3.children[:] {
+			if lvl2 != nil {
+				clear(lvl2.children[:])
+			}
+		}
+	}
+}
+
 // AddIp returns 1 if a new bit is added and 0 if no bits was added
-func AddIp(target *RootLevel, ip string) (uint32, error) {
+func AddIp(target *RootLevel, ip string) (uint64, error) {
 	octetVals, err := util.ParseToOctets(ip)
 	if err != nil {
 		return 0, err
 	}
 
-	lvl3 := target.GetChild(octetVals[0])
-	lvl2 := lvl3.GetChild(octetVals[1])
-	lvl1 := lvl2.GetChild(octetVals[2])
+	return AddParsedIp(target, octetVals), nil
+}
+
+// AddParsedIp is safe to call from multiple goroutines, unlike AddParsedIpOptimistic
+func AddParsedIp(target *RootLevel, ip [4]uint8) uint64 {
+	lvl3 := target.GetChild(ip[0])
+	lvl2 := lvl3.GetChild(ip[1])
+	lvl1 := lvl2.GetChild(ip[2])
 
-	lastByte := octetVals[3]
-	return lvl1.addIp(lastByte), nil
+	lastByte := ip[3]
+	return lvl1.addIp(lastByte)
 }
 
-func AddParsedIpOptimistic(target *RootLevel, ip [4]uint8) uint32 {
+func AddParsedIpOptimistic(target *RootLevel, ip [4]uint8) uint64 {
 	lvl3 := target.GetChildOptimistic(ip[0])
 	lvl2 := lvl3.GetChildOptimistic(ip[1])
 	lvl1 := lvl2.GetChildOptimistic(ip[2])
@@ -69,3 +102,132 @@ func AddParsedIpOptimistic(target *RootLevel, ip [4]uint8) uint32 {
 
 	return lvl1.addBitOptimistic(idx, bit)
 }
+
+// AddRangeOptimistic adds addresses from first to last including both by /24
+// networks, filling whole FirstOctet bitmaps, and returns the number of new ones.
+// Like AddParsedIpOptimistic it must not run concurrently with other writes.
+func AddRangeOptimistic(target *RootLevel, first, last [4]uint8) uint64 {
+	start, end := binary.BigEndian.Uint32(first[:]), binary.BigEndian.Uint32(last[:])
+
+	var added uint64
+	for network := start >> 8; network <= end>>8; network++ {
+		lo, hi := uint8(0), uint8(255)
+		if network == start>>8 {
+			lo = uint8(start)
+		}
+		if network == end>>8 {
+			hi = uint8(end)
+		}
+
+		lvl3 := target.GetChildOptimistic(uint8(network >> 16))
+		lvl2 := lvl3.GetChildOptimistic(uint8(network >> 8))
+		lvl1 := lvl2.GetChildOptimistic(uint8(network))
+		added += lvl1.fillOptimistic(lo, hi)
+	}
+
+	return added
+}
+
+// Contains is safe to call concurrently with AddParsedIp, but not with optimistic adds
+func Contains(target *RootLevel, ip [4]uint8) bool {
+	lvl3 := target.LookupChild(ip[0])
+	if lvl3 == nil {
+		return false
+	}
+	lvl2 := lvl3.LookupChild(ip[1])
+	if lvl2 == nil {
+		return false
+	}
+	lvl1 := lvl2.LookupChild(ip[2])
+	if lvl1 == nil {
+		return false
+	}
+
+	return lvl1.contains(ip[3])
+}
+
+// ContainsMany returns Contains result for every address
+func ContainsMany(target *RootLevel, ips [][4]uint8) []bool {
+	found := make([]bool, len(ips))
+	for i, ip := range ips {
+		found[i] = Contains(target, ip)
+	}
+
+	return found
+}
+
+// All returns an iterator over added addresses in ascending order,
+// it reads children without locks, so it must not run concurrently with adds
+func All(target *RootLevel) func(yield func([4]uint8) bool) {
+	return func(yield func([4]uint8) bool) {
+		for i0, lvl3 := range target.children[:] {
+			if lvl3 == nil {
+				continue
+			}
+			for i1, lvl2 := range lvl3.children[:] {
+				if lvl2 == nil {
+					continue
+				}
+				for i2, lvl1 := range lvl2.children[:] {
+					if lvl1 == nil {
+						continue
+					}
+
+					prefix := [3]uint8{uint8(i0), uint8(i1), uint8(i2)}
+					if !lvl1.yieldAll(prefix, yield) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Blocks yields bitmaps of non-empty /24 networks in ascending order, network
+// is the address >> 8. Like All it must not run concurrently with adds.
+func Blocks(target *RootLevel) func(yield func(network uint32, words [4]uint64) bool) {
+	return func(yield func(network uint32, words [4]uint64) bool) {
+		for i0, lvl3 := range target.children[:] {
+			if lvl3 == nil {
+				continue
+			}
+			for i1, lvl2 := range lvl3.children[:] {
+				if lvl2 == nil {
+					continue
+				}
+				for i2, lvl1 := range lvl2.children[:] {
+					if lvl1 == nil || lvl1.bitmap == [4]uint64{} {
+						continue
+					}
+
+					if !yield(uint32(i0)<<16|uint32(i1)<<8|uint32(i2), lvl1.bitmap) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// OrBlockOptimistic adds addresses of a /24 network from a bitmap yielded
+// by Blocks and returns the number of new ones
+func OrBlockOptimistic(target *RootLevel, network uint32, words [4]uint64) uint64 {
+	lvl3 := target.GetChildOptimistic(uint8(network >> 16))
+	lvl2 := lvl3.GetChildOptimistic(uint8(network >> 8))
+	lvl1 := lvl2.GetChildOptimistic(uint8(network))
+
+	return lvl1.orOptimistic(words)
+}
+
+// Count sums popcounts of all FirstOctet bitmaps,
+// it must not run concurrently with adds
+func Count(target *RootLevel) uint64 {
+	var count uint64
+	for _, child := range target.children[:] {
+		if child != nil {
+			count += countThird(child)
+		}
+	}
+
+	return count
+}
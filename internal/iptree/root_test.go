@@ -0,0 +1,103 @@
+package iptree
+
+import "testing"
+
+func TestAddRangeWholeSpace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fills 2^24 FirstOctet bitmaps")
+	}
+	root := NewRoot(0)
+
+	added := AddRangeOptimistic(root, [4]uint8{0, 0, 0, 0}, [4]uint8{255, 255, 255, 255})
+	if added != 1<<32 {
+		t.Errorf("AddRangeOptimistic added %d, want %d", added, uint64(1)<<32)
+	}
+	if count := Count(root); count != 1<<32 {
+		t.Errorf("Count() = %d, want %d", count, uint64(1)<<32)
+	}
+}
+
+func TestReset(t *testing.T) {
+	root := NewRoot(2)
+	AddParsedIpOptimistic(root, [4]uint8{1, 2, 3, 4})
+	AddRangeOptimistic(root, [4]uint8{10, 0, 0, 0}, [4]uint8{10, 0, 255, 255})
+
+	Reset(root)
+	if count := Count(root); count != 0 {
+		t.Fatalf("Count() after Reset = %d, want 0", count)
+	}
+	if added := AddParsedIpOptimistic(root, [4]uint8{1, 2, 3, 4}); added != 1 {
+		t.Errorf("address added after Reset is not new")
+	}
+	if Count(root) != 1 {
+		t.Errorf("Count() = %d, want 1", Count(root))
+	}
+}
+
+// addReference adds a range to a map of addresses and returns the number of new ones
+func addReference(set map[uint32]bool, first, last [4]uint8) uint64 {
+	var added uint64
+	for addr := uint64(toUint32(first)); addr <= uint64(toUint32(last)); addr++ {
+		if !set[uint32(addr)] {
+			set[uint32(addr)] = true
+			added++
+		}
+	}
+
+	return added
+}
+
+func toUint32(ip [4]uint8) uint32 {
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+func TestAddRangePartialNetworks(t *testing.T) {
+	ranges := [][2][4]uint8{
+		{{10, 0, 0, 5}, {10, 0, 1, 3}},       // partial /24 at both ends
+		{{10, 0, 0, 0}, {10, 0, 0, 10}},      // overlaps the start
+		{{10, 0, 1, 3}, {10, 0, 1, 3}},       // a single address already present
+		{{10, 0, 0, 63}, {10, 0, 0, 64}},     // word boundary inside the bitmap
+		{{10, 0, 0, 200}, {10, 0, 2, 0}},     // overlaps the end
+		{{10, 0, 255, 250}, {10, 1, 0, 10}},  // crosses a /16 boundary
+		{{10, 255, 255, 255}, {11, 0, 0, 0}}, // crosses a /8 boundary
+		{{10, 0, 3, 0}, {10, 0, 3, 255}},     // a whole /24
+		{{10, 0, 2, 128}, {10, 0, 4, 127}},   // covers it and overlaps neighbours
+		{{10, 0, 255, 0}, {10, 1, 0, 255}},   // covers the /16 crossing
+		{{192, 168, 0, 0}, {192, 168, 0, 0}}, // a single new address
+		{{10, 0, 0, 0}, {10, 0, 0, 255}},     // fills the rest of the first /24
+		{{10, 0, 5, 255}, {10, 0, 6, 0}},     // two addresses in two networks
+		{{255, 255, 255, 0}, {255, 255, 255, 255}},
+	}
+
+	for _, root := range []*RootLevel{NewRoot(2), NewEmptyRoot()} {
+		reference := map[uint32]bool{}
+		AddParsedIpOptimistic(root, [4]uint8{10, 0, 0, 7})
+		addReference(reference, [4]uint8{10, 0, 0, 7}, [4]uint8{10, 0, 0, 7})
+
+		for _, r := range ranges {
+			want := addReference(reference, r[0], r[1])
+			if added := AddRangeOptimistic(root, r[0], r[1]); added != want {
+				t.Errorf("%v-%v: added %d, want %d", r[0], r[1], added, want)
+			}
+			if count := Count(root); count != uint64(len(reference)) {
+				t.Fatalf("%v-%v: Count() = %d, want %d", r[0], r[1], count, len(reference))
+			}
+		}
+
+		var prev uint32
+		var got int
+		All(root)(func(ip [4]uint8) bool {
+			addr := toUint32(ip)
+			if !reference[addr] || (got != 0 && addr <= prev) {
+				t.Fatalf("All yields %v after %d addresses", ip, got)
+			}
+			prev = addr
+			got++
+
+			return true
+		})
+		if got != len(reference) {
+			t.Errorf("All yields %d addresses, want %d", got, len(reference))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package iptree
+
+import "math/bits"
+
+// Overlap has sizes of two sets and of their combinations
+type Overlap struct {
+	A            uint64
+	B            uint64
+	Union        uint64
+	Intersection uint64
+	// OnlyA is |A \ B| and OnlyB is |B \ A|
+	OnlyA uint64
+	OnlyB uint64
+}
+
+// Jaccard is |A ∩ B| / |A ∪ B|, 1 for two empty sets
+func (o Overlap) Jaccard() float64 {
+	if o.Union == 0 {
+		return 1
+	}
+
+	return float64(o.Intersection) / float64(o.Union)
+}
+
+// Union, Intersection and Difference build a new tree network by network,
+// combining FirstOctet bitmaps with OR, AND and AND NOT. Like All they must
+// not run concurrently with adds to a or b.
+func Union(a, b *RootLevel) *RootLevel {
+	return combine(a, b, false, func(x, y uint64) uint64 { return x | y })
+}
+
+func Intersection(a, b *RootLevel) *RootLevel {
+	return combine(a, b, true, func(x, y uint64) uint64 { return x & y })
+}
+
+// Difference is a \ b
+func Difference(a, b *RootLevel) *RootLevel {
+	return combine(a, b, false, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// Compare counts sizes without building new trees
+func Compare(a, b *RootLevel) Overlap {
+	var overlap Overlap
+	walkPairs(a, b, false, func(_ uint32, x, y *[4]uint64) {
+		for i := range x {
+			overlap.A += uint64(bits.OnesCount64(x[i]))
+			overlap.B += uint64(bits.OnesCount64(y[i]))
+			overlap.Union += uint64(bits.OnesCount64(x[i] | y[i]))
+			overlap.Intersection += uint64(bits.OnesCount64(x[i] & y[i]))
+			overlap.OnlyA += uint64(bits.OnesCount64(x[i] &^ y[i]))
+			overlap.OnlyB += uint64(bits.OnesCount64(y[i] &^ x[i]))
+		}
+	})
+
+	return overlap
+}
+
+func combine(a, b *RootLevel, needBoth bool, op func(x, y uint64) uint64) *RootLevel {
+	result := NewEmptyRoot()
+	walkPairs(a, b, needBoth, func(network uint32, x, y *[4]uint64) {
+		var words [4]uint64
+		for i := range words {
+			words[i] = op(x[i], y[i])
+		}
+		if words != [4]uint64{} {
+			OrBlockOptimistic(result, network, words)
+		}
+	})
+
+	return result
+}
+
+var emptyBitmap [4]uint64
+
+// walkPairs calls fn for every /24 network present in a or b, with needBoth
+// only for networks present in both, a missing bitmap is passed as empty one
+func walkPairs(a, b *RootLevel, needBoth bool, fn func(network uint32, x, y *[4]uint64)) {
+	for i0 := range a.children {
+		lvl3a, lvl3b := a.children[i0], b.children[i0]
+		if skipPair(lvl3a == nil, lvl3b == nil, needBoth) {
+			continue
+		}
+		for i1 := 0; i1 < 256; i1++ {
+			lvl2a, lvl2b := childOrNil(lvl3a, uint8(i1)), childOrNil(lvl3b, uint8(i1))
+			if skipPair(lvl2a == nil, lvl2b == nil, needBoth) {
+				continue
+			}
+			for i2 := 0; i2 < 256; i2++ {
+				lvl1a, lvl1b := childOrNil(lvl2a, uint8(i2)), childOrNil(lvl2b, uint8(i2))
+				if skipPair(lvl1a == nil, lvl1b == nil, needBoth) {
+					continue
+				}
+
+				x, y := &emptyBitmap, &emptyBitmap
+				if lvl1a != nil {
+					x = &lvl1a.bitmap
+				}
+				if lvl1b != nil {
+					y = &lvl1b.bitmap
+				}
+				fn(uint32(i0)<<16|uint32(i1)<<8|uint32(i2), x, y)
+			}
+		}
+	}
+}
+
+func skipPair(aMissing, bMissing, needBoth bool) bool {
+	if needBoth {
+		return aMissing || bMissing
+	}
+
+	return aMissing && bMissing
+}
+
+func childOrNil[Child Element](lvl *IpOctet[Child], part uint8) *Child {
+	if lvl == nil {
+		return nil
+	}
+
+	return lvl.children[part]
+}
+
+// Merge adds addresses of other to target: FirstOctet bitmaps are ORed and
+// subtrees missing in target are taken from other as is, so other must not
+// be used afterwards. It returns the number of new addresses in target.
+// Neither tree may be changed concurrently.
+func Merge(target, other *RootLevel) uint64 {
+	var added uint64
+	for i0, lvl3o := range other.children[:] {
+		if lvl3o == nil {
+			continue
+		}
+		lvl3t := target.children[i0]
+		if lvl3t == nil {
+			target.children[i0] = lvl3o
+			added += countThird(lvl3o)
+			continue
+		}
+
+		for i1, lvl2o := range lvl3o.children[:] {
+			if lvl2o == nil {
+				continue
+			}
+			lvl2t := lvl3t.children[i1]
+			if lvl2t == nil {
+				lvl3t.children[i1] = lvl2o
+				added += countSecond(lvl2o)
+				continue
+			}
+
+			for i2, lvl1o := range lvl2o.children[:] {
+				if lvl1o == nil {
+					continue
+				}
+				lvl1t := lvl2t.children[i2]
+				if lvl1t == nil {
+					lvl2t.children[i2] = lvl1o
+					added += lvl1o.count()
+					continue
+				}
+
+				added += lvl1t.orOptimistic(lvl1o.bitmap)
+			}
+		}
+	}
+
+	return added
+}
+
+func countThird(lvl *ThirdLevel) uint64 {
+	var count uint64
+	for _, child := range lvl.children[:] {
+		if child != nil {
+			count += countSecond(child)
+		}
+	}
+
+	return count
+}
+
+func countSecond(lvl *SecondLevel) uint64 {
+	var count uint64
+	for _, child := range lvl.children[:] {
+		if child != nil {
+			count += child.count()
+		}
+	}
+
+	return count
+}
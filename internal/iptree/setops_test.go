@@ -0,0 +1,213 @@
+package iptree
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// ipSet is a set of ranges, both ends included
+type ipSet [][2][4]uint8
+
+// tree adds the set to a lazily grown tree or, with prepopulated,
+// to a tree from NewRoot
+func (set ipSet) tree(prepopulated bool) *RootLevel {
+	root := NewEmptyRoot()
+	if prepopulated {
+		root = NewRoot(1)
+	}
+	for _, r := range set {
+		AddRangeOptimistic(root, r[0], r[1])
+	}
+
+	return root
+}
+
+func (set ipSet) reference() map[uint32]bool {
+	reference := map[uint32]bool{}
+	for _, r := range set {
+		addReference(reference, r[0], r[1])
+	}
+
+	return reference
+}
+
+func collect(root *RootLevel) []uint32 {
+	var addrs []uint32
+	All(root)(func(ip [4]uint8) bool {
+		addrs = append(addrs, toUint32(ip))
+		return true
+	})
+
+	return addrs
+}
+
+// filter returns sorted addresses of a and b for which keep is true
+func filter(a, b map[uint32]bool, keep func(inA, inB bool) bool) []uint32 {
+	var addrs []uint32
+	for _, set := range []map[uint32]bool{a, b} {
+		for addr := range set {
+			if keep(a[addr], b[addr]) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	slices.Sort(addrs)
+
+	return slices.Compact(addrs)
+}
+
+var setPairs = []struct {
+	name string
+	a, b ipSet
+}{
+	{"both empty", nil, nil},
+	{"empty a", nil, ipSet{{{10, 0, 0, 1}, {10, 0, 0, 9}}}},
+	{"empty b", ipSet{{{10, 0, 0, 1}, {10, 0, 0, 9}}}, nil},
+	{
+		"disjoint networks",
+		ipSet{{{10, 0, 0, 0}, {10, 0, 1, 255}}, {{1, 2, 3, 4}, {1, 2, 3, 4}}},
+		ipSet{{{11, 0, 0, 0}, {11, 0, 0, 3}}, {{10, 1, 0, 0}, {10, 1, 0, 0}}},
+	},
+	{
+		"disjoint in one /24",
+		ipSet{{{10, 0, 0, 0}, {10, 0, 0, 63}}, {{10, 0, 0, 200}, {10, 0, 0, 200}}},
+		ipSet{{{10, 0, 0, 64}, {10, 0, 0, 199}}, {{10, 0, 0, 201}, {10, 0, 0, 255}}},
+	},
+	{
+		"identical",
+		ipSet{{{10, 0, 0, 5}, {10, 0, 3, 3}}, {{192, 168, 1, 1}, {192, 168, 1, 1}}},
+		ipSet{{{10, 0, 0, 5}, {10, 0, 3, 3}}, {{192, 168, 1, 1}, {192, 168, 1, 1}}},
+	},
+	{
+		"a subset of b",
+		ipSet{{{10, 0, 0, 100}, {10, 0, 1, 10}}},
+		ipSet{{{10, 0, 0, 0}, {10, 0, 255, 255}}, {{8, 8, 8, 8}, {8, 8, 8, 8}}},
+	},
+	{
+		"b subset of a",
+		ipSet{{{10, 0, 0, 0}, {10, 0, 255, 255}}, {{8, 8, 8, 8}, {8, 8, 8, 8}}},
+		ipSet{{{10, 0, 0, 100}, {10, 0, 1, 10}}},
+	},
+	{
+		"partial /24 overlaps",
+		ipSet{{{10, 0, 0, 5}, {10, 0, 1, 3}}, {{10, 0, 2, 60}, {10, 0, 2, 70}}, {{10, 0, 255, 250}, {10, 1, 0, 5}}},
+		ipSet{{{10, 0, 0, 100}, {10, 0, 2, 64}}, {{10, 0, 2, 128}, {10, 0, 2, 130}}, {{10, 1, 0, 0}, {10, 1, 0, 0}}},
+	},
+}
+
+func TestSetOperations(t *testing.T) {
+	for _, pair := range setPairs {
+		// a tree from NewRoot has all upper levels, so it is compared to a lazy one
+		for _, prepopulated := range []bool{false, true} {
+			name := fmt.Sprintf("%s/prepopulated=%t", pair.name, prepopulated)
+			a, b := pair.a.tree(prepopulated), pair.b.tree(false)
+			refA, refB := pair.a.reference(), pair.b.reference()
+
+			union := filter(refA, refB, func(inA, inB bool) bool { return inA || inB })
+			intersection := filter(refA, refB, func(inA, inB bool) bool { return inA && inB })
+			onlyA := filter(refA, refB, func(inA, inB bool) bool { return inA && !inB })
+			onlyB := filter(refA, refB, func(inA, inB bool) bool { return inB && !inA })
+
+			results := []struct {
+				op   string
+				got  *RootLevel
+				want []uint32
+			}{
+				{"Union", Union(a, b), union},
+				{"Intersection", Intersection(a, b), intersection},
+				{"Difference", Difference(a, b), onlyA},
+				{"Difference b a", Difference(b, a), onlyB},
+			}
+			for _, result := range results {
+				if got := collect(result.got); !slices.Equal(got, result.want) {
+					t.Errorf("%s: %s has %d addresses, want %d", name, result.op, len(got), len(result.want))
+				}
+				if count := Count(result.got); count != uint64(len(result.want)) {
+					t.Errorf("%s: Count of %s = %d, want %d", name, result.op, count, len(result.want))
+				}
+			}
+
+			want := Overlap{
+				A:            uint64(len(refA)),
+				B:            uint64(len(refB)),
+				Union:        uint64(len(union)),
+				Intersection: uint64(len(intersection)),
+				OnlyA:        uint64(len(onlyA)),
+				OnlyB:        uint64(len(onlyB)),
+			}
+			if got := Compare(a, b); got != want {
+				t.Errorf("%s: Compare = %+v, want %+v", name, got, want)
+			}
+
+			// operations don't change their arguments
+			if Count(a) != uint64(len(refA)) || Count(b) != uint64(len(refB)) {
+				t.Errorf("%s: arguments have %d and %d addresses after operations, want %d and %d",
+					name, Count(a), Count(b), len(refA), len(refB))
+			}
+		}
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		overlap Overlap
+		want    float64
+	}{
+		{Overlap{}, 1},
+		{Overlap{A: 4, B: 4, Union: 4, Intersection: 4}, 1},
+		{Overlap{A: 2, B: 2, Union: 4, OnlyA: 2, OnlyB: 2}, 0},
+		{Overlap{A: 3, B: 3, Union: 4, Intersection: 2, OnlyA: 1, OnlyB: 1}, 0.5},
+	}
+
+	for _, tc := range tests {
+		if got := tc.overlap.Jaccard(); got != tc.want {
+			t.Errorf("%+v: Jaccard = %f, want %f", tc.overlap, got, tc.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	for _, pair := range setPairs {
+		for _, prepopulated := range []bool{false, true} {
+			name := fmt.Sprintf("%s/prepopulated=%t", pair.name, prepopulated)
+			target, other := pair.a.tree(prepopulated), pair.b.tree(false)
+			refA, refB := pair.a.reference(), pair.b.reference()
+			union := filter(refA, refB, func(inA, inB bool) bool { return inA || inB })
+
+			if added := Merge(target, other); added != uint64(len(union)-len(refA)) {
+				t.Errorf("%s: Merge added %d, want %d", name, added, len(union)-len(refA))
+			}
+			if got := collect(target); !slices.Equal(got, union) {
+				t.Errorf("%s: merged tree has %d addresses, want %d", name, len(got), len(union))
+			}
+			if count := Count(target); count != uint64(len(union)) {
+				t.Errorf("%s: Count() = %d, want %d", name, count, len(union))
+			}
+		}
+	}
+}
+
+// Merge moves subtrees missing in target, that's why other must not be
+// used afterwards: its adds would change target too
+func TestMergeMovesSubtrees(t *testing.T) {
+	target, other := NewEmptyRoot(), NewEmptyRoot()
+	AddParsedIpOptimistic(target, [4]uint8{10, 0, 0, 1})
+	AddParsedIpOptimistic(other, [4]uint8{10, 0, 0, 2}) // ORed into the bitmap of target
+	AddParsedIpOptimistic(other, [4]uint8{10, 0, 1, 1}) // its /24 is moved
+	AddParsedIpOptimistic(other, [4]uint8{11, 0, 0, 1}) // its /8 is moved
+
+	if added := Merge(target, other); added != 3 {
+		t.Fatalf("Merge added %d, want 3", added)
+	}
+
+	AddParsedIpOptimistic(other, [4]uint8{10, 0, 0, 3})
+	AddParsedIpOptimistic(other, [4]uint8{10, 0, 1, 2})
+	AddParsedIpOptimistic(other, [4]uint8{11, 0, 0, 2})
+	if Contains(target, [4]uint8{10, 0, 0, 3}) {
+		t.Errorf("bitmap of target is shared with other")
+	}
+	if !Contains(target, [4]uint8{10, 0, 1, 2}) || !Contains(target, [4]uint8{11, 0, 0, 2}) {
+		t.Errorf("moved subtrees are copied, the rule of Merge can be relaxed")
+	}
+}
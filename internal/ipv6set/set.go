@@ -0,0 +1,70 @@
+// Package ipv6set keeps unique IPv6 addresses. 2^128 addresses can't have
+// a bitmap or a full tree like IPv4, so it is a hash set split into shards
+// with their own locks.
+package ipv6set
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+const SHARD_COUNT = 256
+
+type shard struct {
+	mu    sync.Mutex
+	addrs map[[16]byte]struct{}
+}
+
+// Set is safe for concurrent use, except Reset
+type Set struct {
+	shards [SHARD_COUNT]shard
+	count  atomic.Uint64
+}
+
+func New() *Set {
+	set := &Set{}
+	for i := range set.shards {
+		set.shards[i].addrs = make(map[[16]byte]struct{})
+	}
+
+	return set
+}
+
+// shardIdx mixes both halves, since either the network or the interface
+// part can be the same for many addresses
+func shardIdx(addr [16]byte) int {
+	mixed := binary.LittleEndian.Uint64(addr[:8]) ^ binary.LittleEndian.Uint64(addr[8:])
+
+	return int((mixed * 0x9e3779b97f4a7c15) >> 56)
+}
+
+// Add returns 1 if the address is new and 0 otherwise
+func (s *Set) Add(addr [16]byte) uint64 {
+	shard := &s.shards[shardIdx(addr)]
+
+	shard.mu.Lock()
+	_, found := shard.addrs[addr]
+	if !found {
+		shard.addrs[addr] = struct{}{}
+	}
+	shard.mu.Unlock()
+
+	if found {
+		return 0
+	}
+	s.count.Add(1)
+
+	return 1
+}
+
+func (s *Set) Count() uint64 {
+	return s.count.Load()
+}
+
+func (s *Set) Reset() {
+	for i := range s.shards {
+		s.shards[i].addrs = make(map[[16]byte]struct{})
+	}
+	s.count.Store(0)
+}
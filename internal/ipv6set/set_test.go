@@ -0,0 +1,58 @@
+package ipv6set
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	set := New()
+	addrs := []string{"::", "::1", "2001:db8::1", "2001:db8::2", "2001:db8:0:1::1", "ff02::1"}
+
+	for _, addr := range addrs {
+		if added := set.Add(netip.MustParseAddr(addr).As16()); added != 1 {
+			t.Errorf("%s: Add = %d, want 1", addr, added)
+		}
+	}
+	for _, addr := range addrs {
+		if added := set.Add(netip.MustParseAddr(addr).As16()); added != 0 {
+			t.Errorf("%s again: Add = %d, want 0", addr, added)
+		}
+	}
+
+	if set.Count() != uint64(len(addrs)) {
+		t.Errorf("Count = %d, want %d", set.Count(), len(addrs))
+	}
+
+	set.Reset()
+	if set.Count() != 0 || set.Add(netip.MustParseAddr("::1").As16()) != 1 {
+		t.Errorf("Reset left %d addresses", set.Count())
+	}
+}
+
+func TestAddConcurrent(t *testing.T) {
+	set := New()
+	const workers, perWorker = 4, 10000
+
+	// every worker adds the same addresses, so each is new only once
+	var added [workers]uint64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				var addr [16]byte
+				addr[0], addr[14], addr[15] = 0x20, uint8(i>>8), uint8(i)
+				added[w] += set.Add(addr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := added[0] + added[1] + added[2] + added[3]
+	if total != perWorker || set.Count() != perWorker {
+		t.Errorf("added %d, Count = %d, want %d", total, set.Count(), perWorker)
+	}
+}
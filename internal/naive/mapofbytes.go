@@ -10,7 +10,7 @@ func NewMapOfBytes() map[IpBytes]bool {
 	return make(map[IpBytes]bool)
 }
 
-func AddBytesIp(target map[IpBytes]bool, ip string) (uint32, error) {
+func AddBytesIp(target map[IpBytes]bool, ip string) (uint64, error) {
 	ipBytes, err := util.ParseToOctets(ip)
 	if err != nil {
 		return 0, err
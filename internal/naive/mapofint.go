@@ -8,7 +8,7 @@ func NewMapOfUint() map[uint32]bool {
 	return make(map[uint32]bool)
 }
 
-func AddUintIp(target map[uint32]bool, ip string) (uint32, error) {
+func AddUintIp(target map[uint32]bool, ip string) (uint64, error) {
 	uintIp, err := util.ParseToUint(ip)
 	if err != nil {
 		return 0, err
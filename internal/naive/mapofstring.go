@@ -1,6 +1,6 @@
 package naive
 
-func AddStringIp(target map[string]bool, ip string) uint32 {
+func AddStringIp(target map[string]bool, ip string) uint64 {
 	if target[ip] {
 		return 0
 	}
@@ -0,0 +1,254 @@
+// Package report shows how unique addresses are distributed among /8, /16
+// or /24 networks, as text, CSV, JSON or a heat table
+package report
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_CSV  = "csv"
+	FORMAT_JSON = "json"
+	FORMAT_HEAT = "heat"
+
+	SORT_COUNT  = "count"
+	SORT_SUBNET = "subnet"
+)
+
+var ErrPrefixLength = fmt.Errorf("prefix length must be 8, 16 or 24")
+
+// Subnet is a network with its first address, e.g. 10.0.0.0/8
+type Subnet struct {
+	First     [4]uint8
+	PrefixLen int
+	Unique    uint64
+}
+
+func (s Subnet) String() string {
+	return util.FormatOctets(s.First) + "/" + strconv.Itoa(s.PrefixLen)
+}
+
+// Check validates options before a long run which ends with a report
+func Check(prefixLen int, format, sortBy string) error {
+	if prefixLen != 8 && prefixLen != 16 && prefixLen != 24 {
+		return ErrPrefixLength
+	}
+	if !slices.Contains([]string{FORMAT_TEXT, FORMAT_CSV, FORMAT_JSON, FORMAT_HEAT}, format) {
+		return fmt.Errorf("unsupported format %s, use %s, %s, %s or %s", format, FORMAT_TEXT, FORMAT_CSV, FORMAT_JSON, FORMAT_HEAT)
+	}
+
+	return Sort(nil, sortBy)
+}
+
+// Subnets sums addresses of /24 blocks by networks of prefixLen, only
+// non-empty networks are returned in ascending order. blocks has to yield
+// networks in ascending order, like iptree.Blocks and Bitmap.Blocks do.
+func Subnets(blocks func(yield func(network uint32, words [4]uint64) bool), prefixLen int) ([]Subnet, error) {
+	if prefixLen != 8 && prefixLen != 16 && prefixLen != 24 {
+		return nil, ErrPrefixLength
+	}
+	var subnets []Subnet
+	blocks(func(network uint32, words [4]uint64) bool {
+		var count uint64
+		for _, word := range words {
+			count += uint64(bits.OnesCount64(word))
+		}
+
+		first := [4]uint8{uint8(network >> 16), uint8(network >> 8), uint8(network), 0}
+		for i := prefixLen / 8; i < 3; i++ {
+			first[i] = 0
+		}
+		if len(subnets) == 0 || subnets[len(subnets)-1].First != first {
+			subnets = append(subnets, Subnet{First: first, PrefixLen: prefixLen})
+		}
+		subnets[len(subnets)-1].Unique += count
+
+		return true
+	})
+
+	return subnets, nil
+}
+
+// Sort orders by unique count descending or keeps ascending order of networks
+func Sort(subnets []Subnet, by string) error {
+	switch by {
+	case SORT_SUBNET:
+		return nil
+	case SORT_COUNT:
+		slices.SortStableFunc(subnets, func(a, b Subnet) int {
+			return cmp.Compare(b.Unique, a.Unique)
+		})
+		return nil
+	default:
+		return fmt.Errorf("unsupported sort %s, use %s or %s", by, SORT_COUNT, SORT_SUBNET)
+	}
+}
+
+func share(unique, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(unique) / float64(total)
+}
+
+func total(subnets []Subnet) uint64 {
+	var sum uint64
+	for _, subnet := range subnets {
+		sum += subnet.Unique
+	}
+
+	return sum
+}
+
+// Write writes subnets in format, heat table ignores their order
+func Write(writer io.Writer, subnets []Subnet, format string) error {
+	buffered := bufio.NewWriter(writer)
+	var err error
+	switch format {
+	case FORMAT_TEXT:
+		err = writeText(buffered, subnets)
+	case FORMAT_CSV:
+		err = writeCsv(buffered, subnets)
+	case FORMAT_JSON:
+		err = writeJson(buffered, subnets)
+	case FORMAT_HEAT:
+		err = writeHeat(buffered, subnets)
+	default:
+		return fmt.Errorf("unsupported format %s, use %s, %s, %s or %s", format, FORMAT_TEXT, FORMAT_CSV, FORMAT_JSON, FORMAT_HEAT)
+	}
+	if err != nil {
+		return err
+	}
+
+	return buffered.Flush()
+}
+
+func writeText(writer io.Writer, subnets []Subnet) error {
+	sum := total(subnets)
+	for _, subnet := range subnets {
+		_, err := fmt.Fprintf(writer, "%-18s %10d %7.3f%%\n", subnet, subnet.Unique, share(subnet.Unique, sum)*100)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCsv(writer io.Writer, subnets []Subnet) error {
+	sum := total(subnets)
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"subnet", "unique", "share"})
+	for _, subnet := range subnets {
+		csvWriter.Write([]string{
+			subnet.String(),
+			strconv.FormatUint(subnet.Unique, 10),
+			strconv.FormatFloat(share(subnet.Unique, sum), 'f', 6, 64),
+		})
+	}
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+type jsonSubnet struct {
+	Subnet string  `json:"subnet"`
+	Unique uint64  `json:"unique"`
+	Share  float64 `json:"share"`
+}
+
+func writeJson(writer io.Writer, subnets []Subnet) error {
+	sum := total(subnets)
+	result := make([]jsonSubnet, len(subnets))
+	for i, subnet := range subnets {
+		result[i] = jsonSubnet{Subnet: subnet.String(), Unique: subnet.Unique, Share: share(subnet.Unique, sum)}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// HEAT_SHADES go from an empty network to the largest one, counts are
+// scaled logarithmically, so small networks stay visible
+const HEAT_SHADES = " .:-=+*#%@"
+
+// writeHeat draws a 16x16 table of 256 networks for every non-empty parent
+// network, e.g. all /16 networks of 10.0.0.0/8. Row is the high and column
+// is the low hex digit of the last octet of the prefix.
+func writeHeat(writer io.Writer, subnets []Subnet) error {
+	sorted := slices.Clone(subnets)
+	slices.SortFunc(sorted, func(a, b Subnet) int {
+		return slices.Compare(a.First[:], b.First[:])
+	})
+
+	var maxUnique uint64
+	for _, subnet := range sorted {
+		maxUnique = max(maxUnique, subnet.Unique)
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	fmt.Fprintf(writer, "Shades %q from 0 to %d unique IPs, log scale\n", HEAT_SHADES, maxUnique)
+
+	octetIdx := sorted[0].PrefixLen/8 - 1
+	for start := 0; start < len(sorted); {
+		parent := sorted[start].First
+		parent[octetIdx] = 0
+		end := start
+		var cells [256]uint64
+		for end < len(sorted) && withOctet(sorted[end].First, octetIdx, 0) == parent {
+			cells[sorted[end].First[octetIdx]] = sorted[end].Unique
+			end++
+		}
+
+		if octetIdx == 0 {
+			fmt.Fprintf(writer, "\n0.0.0.0/0\n")
+		} else {
+			fmt.Fprintf(writer, "\n%s/%d\n", util.FormatOctets(parent), octetIdx*8)
+		}
+		fmt.Fprintf(writer, "     0123456789abcdef\n")
+		for row := 0; row < 16; row++ {
+			line := make([]byte, 16)
+			for col := range line {
+				line[col] = shade(cells[row*16+col], maxUnique)
+			}
+			if _, err := fmt.Fprintf(writer, "  %x: %s\n", row, line); err != nil {
+				return err
+			}
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+func withOctet(ip [4]uint8, idx int, value uint8) [4]uint8 {
+	ip[idx] = value
+	return ip
+}
+
+func shade(unique, maxUnique uint64) byte {
+	if unique == 0 {
+		return HEAT_SHADES[0]
+	}
+
+	level := math.Log1p(float64(unique)) / math.Log1p(float64(maxUnique))
+	idx := 1 + int(level*float64(len(HEAT_SHADES)-2)+0.5)
+
+	return HEAT_SHADES[min(idx, len(HEAT_SHADES)-1)]
+}
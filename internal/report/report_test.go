@@ -0,0 +1,165 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+type block struct {
+	network uint32
+	words   [4]uint64
+}
+
+// testBlocks have networks in ascending order like iptree.Blocks
+var testBlocks = []block{
+	{0x000001, [4]uint64{1, 0, 0, 0}},                   // 0.0.1.0/24: 1
+	{0x0A0000, [4]uint64{^uint64(0), 0, 0, 0}},          // 10.0.0.0/24: 64
+	{0x0A0001, [4]uint64{0b111, 0, 0, 1 << 63}},         // 10.0.1.0/24: 4
+	{0x0A0100, [4]uint64{^uint64(0), ^uint64(0), 0, 0}}, // 10.1.0.0/24: 128
+	{0x0AFFFF, [4]uint64{0, 0, 0, 0b11}},                // 10.255.255.0/24: 2
+	{0xC0A801, [4]uint64{0, 1, 0, 0}},                   // 192.168.1.0/24: 1
+	{0xC0A802, [4]uint64{0b1111, 0, 0, 0}},              // 192.168.2.0/24: 4
+}
+
+func yieldBlocks(blocks []block) func(yield func(network uint32, words [4]uint64) bool) {
+	return func(yield func(network uint32, words [4]uint64) bool) {
+		for _, b := range blocks {
+			if !yield(b.network, b.words) {
+				return
+			}
+		}
+	}
+}
+
+func TestSubnets(t *testing.T) {
+	tests := []struct {
+		prefixLen int
+		want      []Subnet
+	}{
+		{8, []Subnet{
+			{[4]uint8{0, 0, 0, 0}, 8, 1},
+			{[4]uint8{10, 0, 0, 0}, 8, 198},
+			{[4]uint8{192, 0, 0, 0}, 8, 5},
+		}},
+		{16, []Subnet{
+			{[4]uint8{0, 0, 0, 0}, 16, 1},
+			{[4]uint8{10, 0, 0, 0}, 16, 68},
+			{[4]uint8{10, 1, 0, 0}, 16, 128},
+			{[4]uint8{10, 255, 0, 0}, 16, 2},
+			{[4]uint8{192, 168, 0, 0}, 16, 5},
+		}},
+		{24, []Subnet{
+			{[4]uint8{0, 0, 1, 0}, 24, 1},
+			{[4]uint8{10, 0, 0, 0}, 24, 64},
+			{[4]uint8{10, 0, 1, 0}, 24, 4},
+			{[4]uint8{10, 1, 0, 0}, 24, 128},
+			{[4]uint8{10, 255, 255, 0}, 24, 2},
+			{[4]uint8{192, 168, 1, 0}, 24, 1},
+			{[4]uint8{192, 168, 2, 0}, 24, 4},
+		}},
+	}
+
+	for _, tc := range tests {
+		got, err := Subnets(yieldBlocks(testBlocks), tc.prefixLen)
+		if err != nil {
+			t.Fatalf("/%d: %v", tc.prefixLen, err)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("/%d: got %v, want %v", tc.prefixLen, got, tc.want)
+		}
+	}
+
+	for _, prefixLen := range []int{0, 4, 12, 20, 32, -8} {
+		if _, err := Subnets(yieldBlocks(testBlocks), prefixLen); !errors.Is(err, ErrPrefixLength) {
+			t.Errorf("/%d: got %v, want %v", prefixLen, err, ErrPrefixLength)
+		}
+		if err := Check(prefixLen, FORMAT_TEXT, SORT_COUNT); !errors.Is(err, ErrPrefixLength) {
+			t.Errorf("Check /%d: got %v, want %v", prefixLen, err, ErrPrefixLength)
+		}
+	}
+
+	if subnets, err := Subnets(yieldBlocks(nil), 16); err != nil || len(subnets) != 0 {
+		t.Errorf("no blocks: got %v, %v", subnets, err)
+	}
+}
+
+func TestSort(t *testing.T) {
+	subnets, _ := Subnets(yieldBlocks(testBlocks), 24)
+
+	bySubnet := slices.Clone(subnets)
+	if err := Sort(bySubnet, SORT_SUBNET); err != nil || !slices.Equal(bySubnet, subnets) {
+		t.Errorf("by subnet: got %v, %v, want ascending networks", bySubnet, err)
+	}
+
+	if err := Sort(subnets, SORT_COUNT); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, subnet := range subnets {
+		order = append(order, subnet.String())
+	}
+	// networks with equal counts stay in ascending order
+	want := []string{
+		"10.1.0.0/24", "10.0.0.0/24", "10.0.1.0/24", "192.168.2.0/24",
+		"10.255.255.0/24", "0.0.1.0/24", "192.168.1.0/24",
+	}
+	if !slices.Equal(order, want) {
+		t.Errorf("by count: got %v, want %v", order, want)
+	}
+
+	if err := Sort(subnets, "size"); err == nil {
+		t.Errorf("unknown sort: got no error")
+	}
+	if err := Check(16, "xml", SORT_COUNT); err == nil {
+		t.Errorf("unknown format: got no error")
+	}
+	if err := Check(16, FORMAT_HEAT, "size"); err == nil {
+		t.Errorf("unknown sort: Check returned no error")
+	}
+}
+
+func TestWriteGolden(t *testing.T) {
+	for _, prefixLen := range []int{8, 16, 24} {
+		for _, format := range []string{FORMAT_TEXT, FORMAT_CSV, FORMAT_JSON, FORMAT_HEAT} {
+			subnets, err := Subnets(yieldBlocks(testBlocks), prefixLen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Sort(subnets, SORT_COUNT); err != nil {
+				t.Fatal(err)
+			}
+
+			var got bytes.Buffer
+			if err := Write(&got, subnets, format); err != nil {
+				t.Fatalf("%s /%d: %v", format, prefixLen, err)
+			}
+
+			golden := filepath.Join("testdata", format+"_"+strconv.Itoa(prefixLen)+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("%s /%d differs from %s:\n%s", format, prefixLen, golden, got.String())
+			}
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, nil, "xml"); err == nil {
+		t.Errorf("unknown format: got no error")
+	}
+}
@@ -0,0 +1,209 @@
+// Package snapshot saves a set of IPv4 addresses to a binary file and loads
+// it back. The set is stored as non-empty /24 networks, dense ones with
+// 256 bit bitmaps, the layout both iptree.FirstOctet and bitmap.Bitmap use,
+// and sparse ones with the list of their last octets:
+//
+//	header:  magic "UIPS", version byte, 3 zero bytes
+//	block:   network uint32 (address >> 8) with the number of addresses n
+//	         in its top byte if n < SPARSE_LIMIT, then
+//	         either n last octets in ascending order (n != 0)
+//	         or 4 x uint64 words, bit i of word j is the address
+//	         network<<8 + j*64 + i (n = 0)
+//	trailer: END_MARKER uint32, block count uint64, address count uint64,
+//	         CRC32 (IEEE) of all previous bytes
+//
+// All numbers are little endian. Networks are written in ascending order.
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+const (
+	MAGIC          = "UIPS"
+	FORMAT_VERSION = 1
+	END_MARKER     = 0xFFFFFFFF
+	HEADER_SIZE    = 8
+	BLOCK_SIZE     = 4 + 4*8
+	TRAILER_SIZE   = 4 + 8 + 8 + 4
+	// SPARSE_LIMIT is the number of addresses from which a list of last
+	// octets is not smaller than the bitmap
+	SPARSE_LIMIT = BLOCK_SIZE - 4
+)
+
+var (
+	ErrFormat   = errors.New("not a snapshot of IP set")
+	ErrChecksum = errors.New("snapshot checksum mismatch")
+)
+
+// Blocks yields non-empty /24 networks in ascending order
+type Blocks = func(yield func(network uint32, words [4]uint64) bool)
+
+// Write returns the number of written addresses
+func Write(writer io.Writer, blocks Blocks) (uint64, error) {
+	checksum := crc32.NewIEEE()
+	buffered := bufio.NewWriterSize(io.MultiWriter(writer, checksum), 1024*1024)
+
+	header := [HEADER_SIZE]byte{MAGIC[0], MAGIC[1], MAGIC[2], MAGIC[3], FORMAT_VERSION}
+	if _, err := buffered.Write(header[:]); err != nil {
+		return 0, err
+	}
+
+	var blockCount, count uint64
+	var err error
+	block := make([]byte, 0, BLOCK_SIZE)
+	blocks(func(network uint32, words [4]uint64) bool {
+		block = appendBlock(block[:0], network, words)
+		for _, word := range words {
+			count += uint64(bits.OnesCount64(word))
+		}
+		blockCount++
+
+		_, err = buffered.Write(block)
+		return err == nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	trailer := binary.LittleEndian.AppendUint32(nil, END_MARKER)
+	trailer = binary.LittleEndian.AppendUint64(trailer, blockCount)
+	trailer = binary.LittleEndian.AppendUint64(trailer, count)
+	if _, err := buffered.Write(trailer); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, err
+	}
+
+	_, err = writer.Write(binary.LittleEndian.AppendUint32(nil, checksum.Sum32()))
+	return count, err
+}
+
+func appendBlock(block []byte, network uint32, words [4]uint64) []byte {
+	count := 0
+	for _, word := range words {
+		count += bits.OnesCount64(word)
+	}
+
+	if count >= SPARSE_LIMIT {
+		block = binary.LittleEndian.AppendUint32(block, network)
+		for _, word := range words {
+			block = binary.LittleEndian.AppendUint64(block, word)
+		}
+		return block
+	}
+
+	block = binary.LittleEndian.AppendUint32(block, network|uint32(count)<<24)
+	for i, word := range words {
+		for word != 0 {
+			block = append(block, uint8(i*64+bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+
+	return block
+}
+
+// Read passes every block to add, which returns the number of new addresses,
+// and returns the sum. The whole snapshot is read and checked before the
+// first add, so a corrupted or truncated one doesn't change the set.
+func Read(reader io.Reader, add func(network uint32, words [4]uint64) uint64) (uint64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) < HEADER_SIZE || string(data[:4]) != MAGIC {
+		return 0, ErrFormat
+	}
+	if data[4] != FORMAT_VERSION {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrFormat, data[4])
+	}
+	if len(data) < HEADER_SIZE+TRAILER_SIZE {
+		return 0, fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+	}
+
+	trailer := data[len(data)-TRAILER_SIZE:]
+	if binary.LittleEndian.Uint32(trailer[TRAILER_SIZE-4:]) != crc32.ChecksumIEEE(data[:len(data)-4]) {
+		return 0, ErrChecksum
+	}
+	if binary.LittleEndian.Uint32(trailer) != END_MARKER {
+		return 0, fmt.Errorf("%w: no end marker", ErrFormat)
+	}
+
+	blocks := data[HEADER_SIZE : len(data)-TRAILER_SIZE]
+	blockCount, count, err := decodeBlocks(blocks, func(uint32, [4]uint64) {})
+	if err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint64(trailer[4:]) != blockCount || binary.LittleEndian.Uint64(trailer[12:]) != count {
+		return 0, fmt.Errorf("%w: wrong counts in trailer", ErrFormat)
+	}
+
+	var added uint64
+	decodeBlocks(blocks, func(network uint32, words [4]uint64) {
+		added += add(network, words)
+	})
+
+	return added, nil
+}
+
+// decodeBlocks calls yield for every block and checks their order,
+// it returns the number of blocks and addresses
+func decodeBlocks(data []byte, yield func(network uint32, words [4]uint64)) (uint64, uint64, error) {
+	var blockCount, count uint64
+	prevNetwork := -1
+	for len(data) != 0 {
+		if len(data) < 4 {
+			return 0, 0, fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+		}
+		network := binary.LittleEndian.Uint32(data)
+		sparseCount := int(network >> 24)
+		network &= 0xFFFFFF
+		data = data[4:]
+
+		if int(network) <= prevNetwork {
+			return 0, 0, fmt.Errorf("%w: network %d out of order", ErrFormat, network)
+		}
+		prevNetwork = int(network)
+		if sparseCount >= SPARSE_LIMIT {
+			return 0, 0, fmt.Errorf("%w: network %d has a wrong size", ErrFormat, network)
+		}
+
+		var words [4]uint64
+		if sparseCount == 0 {
+			if len(data) < BLOCK_SIZE-4 {
+				return 0, 0, fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+			}
+			for i := range words {
+				words[i] = binary.LittleEndian.Uint64(data[i*8:])
+				count += uint64(bits.OnesCount64(words[i]))
+			}
+			data = data[BLOCK_SIZE-4:]
+		} else {
+			if len(data) < sparseCount {
+				return 0, 0, fmt.Errorf("%w: %w", ErrFormat, io.ErrUnexpectedEOF)
+			}
+			for i, octet := range data[:sparseCount] {
+				if i != 0 && octet <= data[i-1] {
+					return 0, 0, fmt.Errorf("%w: octets of network %d out of order", ErrFormat, network)
+				}
+				words[octet/64] |= 1 << (octet % 64)
+			}
+			count += uint64(sparseCount)
+			data = data[sparseCount:]
+		}
+		blockCount++
+
+		yield(network, words)
+	}
+
+	return blockCount, count, nil
+}
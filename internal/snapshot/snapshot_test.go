@@ -0,0 +1,125 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+type block struct {
+	network uint32
+	words   [4]uint64
+}
+
+var testBlocks = []block{
+	{0, [4]uint64{1, 0, 0, 0}},                                            // 0.0.0.0
+	{1, [4]uint64{0, 0, 0, 1 << 63}},                                      // 0.0.1.255
+	{0x0a0000, [4]uint64{0xFF, 0, 0xF0F0, 1}},                             // sparse with 17
+	{0x0a0001, [4]uint64{0xFFFFFFFF, 0, 0, 0}},                            // dense with 32
+	{0xFFFFFF, [4]uint64{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}}, // full
+}
+
+func blocksOf(list []block) Blocks {
+	return func(yield func(network uint32, words [4]uint64) bool) {
+		for _, b := range list {
+			if !yield(b.network, b.words) {
+				return
+			}
+		}
+	}
+}
+
+func write(t *testing.T, list []block) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Write(&buf, blocksOf(list)); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func read(data []byte) ([]block, uint64, error) {
+	var got []block
+	added, err := Read(bytes.NewReader(data), func(network uint32, words [4]uint64) uint64 {
+		got = append(got, block{network, words})
+		return 1
+	})
+
+	return got, added, err
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := write(t, testBlocks)
+
+	got, added, err := read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != uint64(len(testBlocks)) {
+		t.Errorf("added %d, want %d", added, len(testBlocks))
+	}
+	if len(got) != len(testBlocks) {
+		t.Fatalf("read %d blocks, want %d", len(got), len(testBlocks))
+	}
+	for i := range got {
+		if got[i] != testBlocks[i] {
+			t.Errorf("block %d is %+v, want %+v", i, got[i], testBlocks[i])
+		}
+	}
+}
+
+func TestSparseBlocksAreSmaller(t *testing.T) {
+	single := write(t, []block{{5, [4]uint64{1, 0, 0, 0}}})
+	if size := len(single) - HEADER_SIZE - TRAILER_SIZE; size != 5 {
+		t.Errorf("block with one address takes %d bytes, want 5", size)
+	}
+}
+
+func TestCorruptedAddsNothing(t *testing.T) {
+	data := write(t, testBlocks)
+
+	tests := map[string][]byte{
+		"truncated":    data[:len(data)-10],
+		"no trailer":   data[:HEADER_SIZE+20],
+		"flipped bit":  append(append([]byte(nil), data[:20]...), append([]byte{data[20] ^ 1}, data[21:]...)...),
+		"extra byte":   append(append([]byte(nil), data...), 0),
+		"wrong magic":  append([]byte("XIPS"), data[4:]...),
+		"empty":        nil,
+		"only header":  data[:HEADER_SIZE],
+		"missing tail": data[:len(data)-1],
+	}
+
+	for name, corrupted := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, added, err := read(corrupted)
+			if err == nil {
+				t.Fatal("corrupted snapshot is accepted")
+			}
+			if !errors.Is(err, ErrFormat) && !errors.Is(err, ErrChecksum) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if len(got) != 0 || added != 0 {
+				t.Errorf("%d blocks were added before the error", len(got))
+			}
+		})
+	}
+}
+
+func TestValidChecksumWrongBlocks(t *testing.T) {
+	// octets out of order with a matching checksum
+	data := []byte{MAGIC[0], MAGIC[1], MAGIC[2], MAGIC[3], FORMAT_VERSION, 0, 0, 0}
+	data = binary.LittleEndian.AppendUint32(data, 7|2<<24)
+	data = append(data, 9, 3)
+	data = binary.LittleEndian.AppendUint32(data, END_MARKER)
+	data = binary.LittleEndian.AppendUint64(data, 1)
+	data = binary.LittleEndian.AppendUint64(data, 2)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	got, _, err := read(data)
+	if !errors.Is(err, ErrFormat) || len(got) != 0 {
+		t.Errorf("got %d blocks and %v, want ErrFormat", len(got), err)
+	}
+}
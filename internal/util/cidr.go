@@ -0,0 +1,111 @@
+package util
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// Cidr is a network with its first address, e.g. 10.0.0.0/8
+type Cidr struct {
+	First     [4]uint8
+	PrefixLen int
+}
+
+func (c Cidr) String() string {
+	return string(c.append(nil))
+}
+
+func (c Cidr) append(buf []byte) []byte {
+	buf = append(AppendOctets(buf, c.First), '/')
+	return strconv.AppendInt(buf, int64(c.PrefixLen), 10)
+}
+
+// CidrCover returns an iterator over the minimal list of CIDR blocks that
+// covers exactly the addresses of blocks in ascending order. blocks yields
+// /24 networks in ascending order, bit i of words[j] is the address
+// network<<8 + j*64 + i, like iptree.Blocks and Bitmap.Blocks do.
+func CidrCover(blocks func(yield func(network uint32, words [4]uint64) bool)) func(yield func(Cidr) bool) {
+	return func(yield func(Cidr) bool) {
+		// current run of addresses is [start, end), uint64 fits 2^32
+		var start, end uint64
+		stopped := false
+		blocks(func(network uint32, words [4]uint64) bool {
+			for idx, word := range words {
+				base := uint64(network)<<8 + uint64(idx)*64
+				for word != 0 {
+					offset := bits.TrailingZeros64(word)
+					length := bits.TrailingZeros64(^(word >> offset))
+					if offset+length > 64 {
+						length = 64 - offset
+					}
+					word &^= (^uint64(0) >> (64 - length)) << offset
+
+					runStart := base + uint64(offset)
+					if runStart != end || start == end {
+						if !yieldRange(start, end, yield) {
+							stopped = true
+							return false
+						}
+						start = runStart
+					}
+					end = runStart + uint64(length)
+				}
+			}
+
+			return true
+		})
+
+		if !stopped {
+			yieldRange(start, end, yield)
+		}
+	}
+}
+
+// yieldRange splits [start, end) into the largest aligned blocks
+func yieldRange(start, end uint64, yield func(Cidr) bool) bool {
+	for start < end {
+		size := uint64(1) << 32
+		if start != 0 {
+			size = start & -start
+		}
+		for size > end-start {
+			size >>= 1
+		}
+
+		var first [4]uint8
+		binary.BigEndian.PutUint32(first[:], uint32(start))
+		if !yield(Cidr{First: first, PrefixLen: 32 - bits.TrailingZeros64(size)}) {
+			return false
+		}
+		start += size
+	}
+
+	return true
+}
+
+// WriteCidrs writes every block of CidrCover on its own line
+// and returns the number of written blocks
+func WriteCidrs(writer io.Writer, blocks func(yield func(network uint32, words [4]uint64) bool)) (uint64, error) {
+	buffered := bufio.NewWriterSize(writer, 1024*1024)
+	line := make([]byte, 0, 20)
+
+	var count uint64
+	var err error
+	CidrCover(blocks)(func(cidr Cidr) bool {
+		line = append(cidr.append(line[:0]), '\n')
+		if _, err = buffered.Write(line); err != nil {
+			return false
+		}
+		count++
+
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, buffered.Flush()
+}
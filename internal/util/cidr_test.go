@@ -0,0 +1,151 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// rangeBlocks yields /24 blocks of ranges, which have to be ascending and not overlap
+func rangeBlocks(ranges [][2]string) func(yield func(network uint32, words [4]uint64) bool) {
+	return func(yield func(network uint32, words [4]uint64) bool) {
+		var network uint32
+		var words [4]uint64
+		empty := true
+		for _, r := range ranges {
+			first, _ := ParseToOctets(r[0])
+			last, _ := ParseToOctets(r[1])
+			for addr := uint64(binary.BigEndian.Uint32(first[:])); addr <= uint64(binary.BigEndian.Uint32(last[:])); addr++ {
+				if !empty && uint32(addr>>8) != network {
+					if !yield(network, words) {
+						return
+					}
+					words, empty = [4]uint64{}, true
+				}
+				network, empty = uint32(addr>>8), false
+				words[addr&0xFF/64] |= 1 << (addr % 64)
+			}
+		}
+		if !empty {
+			yield(network, words)
+		}
+	}
+}
+
+func cidrStrings(blocks func(yield func(network uint32, words [4]uint64) bool)) []string {
+	var got []string
+	CidrCover(blocks)(func(cidr Cidr) bool {
+		got = append(got, cidr.String())
+		return true
+	})
+
+	return got
+}
+
+func TestCidrCover(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges [][2]string
+		want   []string
+	}{
+		{"empty", nil, nil},
+		{"single address", [][2]string{{"1.2.3.4", "1.2.3.4"}}, []string{"1.2.3.4/32"}},
+		{"first and last address", [][2]string{{"0.0.0.0", "0.0.0.0"}, {"255.255.255.255", "255.255.255.255"}},
+			[]string{"0.0.0.0/32", "255.255.255.255/32"}},
+		{"separate addresses", [][2]string{{"1.2.3.4", "1.2.3.4"}, {"1.2.3.6", "1.2.3.6"}},
+			[]string{"1.2.3.4/32", "1.2.3.6/32"}},
+		{"aligned /24", [][2]string{{"10.0.0.0", "10.0.0.255"}}, []string{"10.0.0.0/24"}},
+		{"aligned /16", [][2]string{{"10.1.0.0", "10.1.255.255"}}, []string{"10.1.0.0/16"}},
+		{"adjacent halves", [][2]string{{"10.0.0.0", "10.0.0.127"}, {"10.0.0.128", "10.0.0.255"}}, []string{"10.0.0.0/24"}},
+		{"two /24 make a /23", [][2]string{{"10.0.2.0", "10.0.3.255"}}, []string{"10.0.2.0/23"}},
+		{"unaligned /24", [][2]string{{"10.0.1.0", "10.0.1.255"}, {"10.0.2.0", "10.0.2.255"}}, []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		{"across word boundary", [][2]string{{"10.0.0.60", "10.0.0.70"}},
+			[]string{"10.0.0.60/30", "10.0.0.64/30", "10.0.0.68/31", "10.0.0.70/32"}},
+		{"across /24 boundary", [][2]string{{"10.0.0.250", "10.0.1.5"}},
+			[]string{"10.0.0.250/31", "10.0.0.252/30", "10.0.1.0/30", "10.0.1.4/31"}},
+		{"across /16 boundary", [][2]string{{"10.0.255.0", "10.1.0.255"}}, []string{"10.0.255.0/24", "10.1.0.0/24"}},
+		{"run over many networks", [][2]string{{"10.0.0.1", "10.0.4.0"}}, []string{
+			"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27",
+			"10.0.0.64/26", "10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/23", "10.0.4.0/32",
+		}},
+	}
+
+	for _, tc := range tests {
+		if got := cidrStrings(rangeBlocks(tc.ranges)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCidrCoverWholeSpace(t *testing.T) {
+	full := [4]uint64{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}
+	space := func(skipLast bool) func(yield func(network uint32, words [4]uint64) bool) {
+		return func(yield func(network uint32, words [4]uint64) bool) {
+			for network := uint32(0); network < 1<<24; network++ {
+				words := full
+				if skipLast && network == 1<<24-1 {
+					words[3] &^= 1 << 63
+				}
+				if !yield(network, words) {
+					return
+				}
+			}
+		}
+	}
+
+	if got := cidrStrings(space(false)); !slices.Equal(got, []string{"0.0.0.0/0"}) {
+		t.Errorf("whole space: got %v", got)
+	}
+
+	// all but 255.255.255.255 takes a block of every size from /1 to /32
+	got := cidrStrings(space(true))
+	if len(got) != 32 || got[0] != "0.0.0.0/1" || got[1] != "128.0.0.0/2" || got[31] != "255.255.255.254/32" {
+		t.Errorf("all but the last address: got %d blocks %v", len(got), got)
+	}
+}
+
+func TestYieldRange(t *testing.T) {
+	tests := []struct {
+		start, end uint64
+		want       []string
+	}{
+		{0, 0, nil},
+		{0, 1 << 32, []string{"0.0.0.0/0"}},
+		{0, 1 << 31, []string{"0.0.0.0/1"}},
+		{1 << 31, 1 << 32, []string{"128.0.0.0/1"}},
+		{1, 4, []string{"0.0.0.1/32", "0.0.0.2/31"}},
+		{1<<32 - 1, 1 << 32, []string{"255.255.255.255/32"}},
+		{0x0A000005, 0x0A00000B, []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/31", "10.0.0.10/32"}},
+	}
+
+	for _, tc := range tests {
+		var got []string
+		yieldRange(tc.start, tc.end, func(cidr Cidr) bool {
+			got = append(got, cidr.String())
+			return true
+		})
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("[%d, %d): got %v, want %v", tc.start, tc.end, got, tc.want)
+		}
+	}
+
+	// stops as soon as yield returns false
+	var yielded int
+	finished := yieldRange(1, 1<<32, func(Cidr) bool {
+		yielded++
+		return yielded < 2
+	})
+	if finished || yielded != 2 {
+		t.Errorf("stopped at 2: got %d blocks, finished %t", yielded, finished)
+	}
+}
+
+func TestWriteCidrs(t *testing.T) {
+	var buf bytes.Buffer
+	count, err := WriteCidrs(&buf, rangeBlocks([][2]string{{"10.0.0.250", "10.0.1.5"}, {"192.168.0.0", "192.168.255.255"}}))
+	want := "10.0.0.250/31\n10.0.0.252/30\n10.0.1.0/30\n10.0.1.4/31\n192.168.0.0/16\n"
+	if err != nil || count != 5 || buf.String() != want {
+		t.Errorf("got %d blocks %q (%v), want 5 blocks %q", count, buf.String(), err, want)
+	}
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	COMPRESSION_NONE  = "none"
+	COMPRESSION_GZIP  = "gzip"
+	COMPRESSION_ZSTD  = "zstd"
+	COMPRESSION_BZIP2 = "bzip2"
+	COMPRESSION_XZ    = "xz"
+
+	DECOMPRESS_BUFFER_SIZE = 1024 * 1024
+)
+
+var magicBytes = []struct {
+	compression string
+	magic       []byte
+}{
+	{COMPRESSION_GZIP, []byte{0x1f, 0x8b}},
+	{COMPRESSION_ZSTD, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{COMPRESSION_BZIP2, []byte("BZh")},
+	{COMPRESSION_XZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// DetectCompression checks magic bytes at the start of the input
+func DetectCompression(header []byte) string {
+	for _, format := range magicBytes {
+		if bytes.HasPrefix(header, format.magic) {
+			return format.compression
+		}
+	}
+
+	return COMPRESSION_NONE
+}
+
+// Decompress detects compression by magic bytes and returns a reader of
+// decompressed data, uncompressed input is only buffered. Closing the result
+// doesn't close reader.
+func Decompress(reader io.Reader) (io.ReadCloser, string, error) {
+	buffered := bufio.NewReaderSize(reader, DECOMPRESS_BUFFER_SIZE)
+	// error means input is shorter than any magic, so it can't be compressed
+	header, _ := buffered.Peek(8)
+
+	compression := DetectCompression(header)
+	switch compression {
+	case COMPRESSION_GZIP:
+		// pgzip decompresses blocks ahead in its own goroutine
+		gzipReader, err := pgzip.NewReader(buffered)
+		return gzipReader, compression, err
+	case COMPRESSION_ZSTD:
+		zstdReader, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, compression, err
+		}
+		return zstdReader.IOReadCloser(), compression, nil
+	case COMPRESSION_BZIP2:
+		return io.NopCloser(bzip2.NewReader(buffered)), compression, nil
+	case COMPRESSION_XZ:
+		xzReader, err := xz.NewReader(buffered)
+		return io.NopCloser(xzReader), compression, err
+	default:
+		return io.NopCloser(buffered), compression, nil
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var compressedFixtures = []struct {
+	filename    string
+	compression string
+}{
+	{"ips.txt", COMPRESSION_NONE},
+	{"ips.txt.gz", COMPRESSION_GZIP},
+	{"ips.txt.zst", COMPRESSION_ZSTD},
+	{"ips.txt.bz2", COMPRESSION_BZIP2},
+	{"ips.txt.xz", COMPRESSION_XZ},
+}
+
+func TestDecompress(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "ips.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range compressedFixtures {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, compression, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", fixture.filename, err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+
+		if err != nil || compression != fixture.compression || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q as %s (%v), want %q as %s",
+				fixture.filename, got, compression, err, want, fixture.compression)
+		}
+	}
+}
+
+func TestDecompressShortInput(t *testing.T) {
+	for _, input := range []string{"", "1", "1.2.3.4"} {
+		reader, compression, err := Decompress(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil || compression != COMPRESSION_NONE || string(got) != input {
+			t.Errorf("%q: got %q as %s (%v)", input, got, compression, err)
+		}
+	}
+}
+
+func TestOpenInput(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "ips.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range compressedFixtures {
+		input, err := OpenInput(filepath.Join("testdata", fixture.filename))
+		if err != nil {
+			t.Fatalf("%s: %v", fixture.filename, err)
+		}
+		got, err := io.ReadAll(input)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q (%v), want %q", fixture.filename, got, err, want)
+		}
+		if err := input.Close(); err != nil {
+			t.Errorf("%s: close: %v", fixture.filename, err)
+		}
+	}
+
+	if _, err := OpenInput(filepath.Join("testdata", "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v, want not exist error", err)
+	}
+}
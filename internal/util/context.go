@@ -0,0 +1,39 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// NotifyContext is cancelled on SIGINT or SIGTERM, and after timeout unless it's zero
+func NotifyContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	if timeout == 0 {
+		return ctx, stop
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	return timeoutCtx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// IsCancellation tells if the run was stopped by a signal or deadline rather than failed
+func IsCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// SendOrDone returns false if ctx is cancelled before value is sent
+func SendOrDone[T any](ctx context.Context, ch chan<- T, value T) bool {
+	select {
+	case ch <- value:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
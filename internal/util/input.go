@@ -0,0 +1,132 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// STDIN_NAME can be passed instead of a file name to use standard input or output
+const STDIN_NAME = "-"
+
+// OpenInput opens a file by name or returns stdin for STDIN_NAME,
+// compressed input is decompressed on the fly (see Decompress)
+func OpenInput(filename string) (io.ReadCloser, error) {
+	var file io.ReadCloser = io.NopCloser(os.Stdin)
+	if filename != STDIN_NAME {
+		var err error
+		if file, err = os.Open(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	decompressed, _, err := Decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &decompressedInput{Reader: decompressed, decompressed: decompressed, file: file}, nil
+}
+
+type decompressedInput struct {
+	io.Reader
+	decompressed io.Closer
+	file         io.Closer
+}
+
+func (di *decompressedInput) Close() error {
+	return errors.Join(di.decompressed.Close(), di.file.Close())
+}
+
+// CreateOutput creates a file by name or returns stdout for STDIN_NAME
+func CreateOutput(filename string) (io.WriteCloser, error) {
+	if filename == STDIN_NAME {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+
+	return os.Create(filename)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// ExpandInputs turns globs and directories into file names, other names
+// including STDIN_NAME are kept as is. Directories are walked recursively
+// only with recursive, files of a directory or a glob are sorted by name.
+// Like in the shell, globs match hidden files only if their last element
+// starts with a dot.
+func ExpandInputs(patterns []string, recursive bool) ([]string, error) {
+	var filenames []string
+	for _, pattern := range patterns {
+		if pattern == STDIN_NAME {
+			filenames = append(filenames, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if matches == nil {
+			// no such file, keep it to report the error on open
+			matches = []string{pattern}
+		}
+
+		showHidden := strings.HasPrefix(filepath.Base(pattern), ".")
+		for _, match := range matches {
+			if !showHidden && strings.HasPrefix(filepath.Base(match), ".") {
+				continue
+			}
+
+			info, err := os.Stat(match)
+			if err != nil || !info.IsDir() {
+				filenames = append(filenames, match)
+				continue
+			}
+
+			dirFiles, err := listDir(match, recursive)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, dirFiles...)
+		}
+	}
+
+	return filenames, nil
+}
+
+// listDir skips hidden files, WalkDir returns names in lexical order
+func listDir(dir string, recursive bool) ([]string, error) {
+	var filenames []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		filenames = append(filenames, path)
+		return nil
+	})
+
+	return filenames, err
+}
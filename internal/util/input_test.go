@@ -0,0 +1,61 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"b.log", "a.log", "c.txt", ".hidden.log",
+		"logs/2.log", "logs/1.log", "logs/deep/0.log", ".git/x.log",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("1.2.3.4\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(names ...string) []string {
+		for i, name := range names {
+			names[i] = filepath.Join(dir, name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		recursive bool
+		want      []string
+	}{
+		{"stdin", []string{STDIN_NAME}, false, []string{STDIN_NAME}},
+		{"missing file", in("none.log"), false, in("none.log")},
+		{"glob", in("*.log"), false, in("a.log", "b.log")},
+		{"order of patterns", append(in("c.txt"), in("*.log")...), false, in("c.txt", "a.log", "b.log")},
+		{"directory", in(""), false, in("a.log", "b.log", "c.txt")},
+		{"recursive", in(""), true, in("a.log", "b.log", "c.txt", "logs/1.log", "logs/2.log", "logs/deep/0.log")},
+		{"glob of directories", in("log*"), true, in("logs/1.log", "logs/2.log", "logs/deep/0.log")},
+		{"hidden file by name", in(".hidden.log"), false, in(".hidden.log")},
+		{"glob of hidden files", in(".*.log"), false, in(".hidden.log")},
+	}
+
+	for _, test := range tests {
+		got, err := ExpandInputs(test.patterns, test.recursive)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := ExpandInputs([]string{"[bad"}, false); err == nil {
+		t.Errorf("bad pattern: got no error")
+	}
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// ErrorPolicy tells what to do with lines that can't be parsed
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyFail stops on the first malformed line
+	ErrorPolicyFail ErrorPolicy = iota
+	// ErrorPolicySkip ignores malformed lines
+	ErrorPolicySkip
+	// ErrorPolicyCollect ignores malformed lines, but counts them and keeps a sample
+	ErrorPolicyCollect
+)
+
+const MALFORMED_SAMPLE_SIZE = 10
+
+var errorPolicyNames = []string{"fail", "skip", "collect"}
+
+func (p ErrorPolicy) String() string {
+	if int(p) < len(errorPolicyNames) {
+		return errorPolicyNames[p]
+	}
+
+	return fmt.Sprintf("ErrorPolicy(%d)", int(p))
+}
+
+// Set allows to use ErrorPolicy as a flag.Value
+func (p *ErrorPolicy) Set(name string) error {
+	idx := slices.Index(errorPolicyNames, name)
+	if idx == -1 {
+		return fmt.Errorf("unknown error policy %s, expected one of %v", name, errorPolicyNames)
+	}
+	*p = ErrorPolicy(idx)
+
+	return nil
+}
+
+type MalformedLine struct {
+	// Line is 1-based number of the line in the input
+	Line uint64
+	Err  error
+}
+
+// Malformed counts malformed lines and keeps the first MALFORMED_SAMPLE_SIZE of them
+type Malformed struct {
+	Count  uint64
+	Sample []MalformedLine
+}
+
+func (m *Malformed) Add(line uint64, err error) {
+	m.Count++
+	if len(m.Sample) < MALFORMED_SAMPLE_SIZE {
+		m.Sample = append(m.Sample, MalformedLine{Line: line, Err: err})
+	}
+}
+
+// Merge keeps the first lines of both samples, so merging samples of
+// parallel workers gives the same result as a single worker would
+func (m *Malformed) Merge(other Malformed) {
+	m.Count += other.Count
+	m.Sample = append(m.Sample, other.Sample...)
+	slices.SortFunc(m.Sample, func(a, b MalformedLine) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+
+	if len(m.Sample) > MALFORMED_SAMPLE_SIZE {
+		m.Sample = m.Sample[:MALFORMED_SAMPLE_SIZE]
+	}
+}
+
+// LogMalformed prints the count and the sample of malformed lines
+func LogMalformed(logger *log.Logger, malformed Malformed) {
+	logger.Printf("Malformed lines: %d\n", malformed.Count)
+	for _, line := range malformed.Sample {
+		logger.Printf("  line %d: %s\n", line.Line, line.Err)
+	}
+}
+
+// LineBatch keeps 1-based number of the first line for error messages
+type LineBatch struct {
+	Lines     []string
+	FirstLine uint64
+}
@@ -0,0 +1,30 @@
+package util
+
+import (
+	"bufio"
+	"io"
+)
+
+// WriteIps writes every address yielded by all on its own line
+// and returns the number of written addresses
+func WriteIps(writer io.Writer, all func(yield func([4]uint8) bool)) (uint64, error) {
+	buffered := bufio.NewWriterSize(writer, 1024*1024)
+	line := make([]byte, 0, 16)
+
+	var count uint64
+	var err error
+	all(func(ip [4]uint8) bool {
+		line = append(AppendOctets(line[:0], ip), '\n')
+		if _, err = buffered.Write(line); err != nil {
+			return false
+		}
+		count++
+
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, buffered.Flush()
+}
@@ -2,30 +2,118 @@ package util
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 )
 
-func ParseToOctets(ip string) ([4]uint8, error) {
-	strOctets := strings.Split(ip, ".")
+var (
+	ErrSyntax     = errors.New("invalid syntax")
+	ErrOctetCount = errors.New("wrong number of octets")
+	ErrOctetRange = errors.New("octet out of range")
+)
+
+// ParseError is returned by parsing functions, Err is one of ErrSyntax,
+// ErrOctetCount, ErrOctetRange, ErrIpv6Syntax, ErrPrefixLength or ErrRangeOrder,
+// so errors.Is can be used to check it
+type ParseError struct {
+	Ip    string
+	Octet string
+	Err   error
+}
 
-	if len(strOctets) != 4 {
-		return [4]uint8{}, fmt.Errorf("Invalid IP %s", ip)
+func (e *ParseError) Error() string {
+	switch e.Err {
+	case ErrOctetCount, ErrIpv6Syntax, ErrPrefixLength, ErrRangeOrder, ErrRangeSize:
+		return fmt.Sprintf("Invalid IP '%s': %s", e.Ip, e.Err)
 	}
 
+	return fmt.Sprintf("Invalid IP '%s', octet '%s': %s", e.Ip, e.Octet, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseToOctets accepts only 4 decimal octets from 0 to 255 separated by dots,
+// without signs or spaces. Leading zeros are allowed, "01" is parsed as 1.
+func ParseToOctets(ip string) ([4]uint8, error) {
+	return parseOctets(ip, true)
+}
+
+// ParseToOctetsCanonical is like ParseToOctets, but also rejects leading zeros
+func ParseToOctetsCanonical(ip string) ([4]uint8, error) {
+	return parseOctets(ip, false)
+}
+
+// ParseOctetsBytes is ParseToOctets for byte slices, it doesn't allocate
+// unless the line is invalid, so it can parse lines right in a read buffer
+func ParseOctetsBytes(ip []byte) ([4]uint8, error) {
+	return parseOctets(ip, true)
+}
+
+// ParseOctetsBytesCanonical is ParseToOctetsCanonical for byte slices
+func ParseOctetsBytesCanonical(ip []byte) ([4]uint8, error) {
+	return parseOctets(ip, false)
+}
+
+func parseOctets[T string | []byte](ip T, allowLeadingZeros bool) ([4]uint8, error) {
 	result := [4]uint8{}
-	for i := 0; i < 4; i++ {
-		number, err := strconv.Atoi(strOctets[i])
+	octetIdx := 0
+	start := 0
+	for i := 0; i <= len(ip); i++ {
+		if i != len(ip) && ip[i] != '.' {
+			continue
+		}
+
+		if octetIdx == 4 {
+			return [4]uint8{}, &ParseError{Ip: string(ip), Err: ErrOctetCount}
+		}
+
+		octet := ip[start:i]
+		value, err := parseOctet(octet, allowLeadingZeros)
 		if err != nil {
-			return [4]uint8{}, fmt.Errorf("Invalid octet '%s'", strOctets[i])
+			return [4]uint8{}, &ParseError{Ip: string(ip), Octet: string(octet), Err: err}
 		}
-		result[i] = uint8(number)
+
+		result[octetIdx] = value
+		octetIdx++
+		start = i + 1
+	}
+
+	if octetIdx != 4 {
+		return [4]uint8{}, &ParseError{Ip: string(ip), Err: ErrOctetCount}
 	}
 
 	return result, nil
 }
 
+func parseOctet[T string | []byte](octet T, allowLeadingZeros bool) (uint8, error) {
+	if len(octet) == 0 {
+		return 0, ErrSyntax
+	}
+	if !allowLeadingZeros && len(octet) > 1 && octet[0] == '0' {
+		return 0, ErrSyntax
+	}
+
+	value := 0
+	for i := 0; i < len(octet); i++ {
+		digit := octet[i] - '0'
+		if digit > 9 {
+			return 0, ErrSyntax
+		}
+
+		// values above 255 are capped, so long octets don't overflow
+		value = min(value*10+int(digit), 256)
+	}
+
+	if value > 255 {
+		return 0, ErrOctetRange
+	}
+
+	return uint8(value), nil
+}
+
 func ParseToUint(ip string) (uint32, error) {
 	octets, err := ParseToOctets(ip)
 
@@ -33,5 +121,27 @@ func ParseToUint(ip string) (uint32, error) {
 		return 0, err
 	}
 
-	return binary.LittleEndian.Uint32(octets[:]), nil
+	return OctetsToUint(octets), nil
+}
+
+// OctetsToUint packs octets the same way ParseToUint does
+func OctetsToUint(octets [4]uint8) uint32 {
+	return binary.LittleEndian.Uint32(octets[:])
+}
+
+// FormatOctets is the reverse of ParseToOctets
+func FormatOctets(octets [4]uint8) string {
+	return string(AppendOctets(make([]byte, 0, 15), octets))
+}
+
+// AppendOctets appends dotted form of octets to buf
+func AppendOctets(buf []byte, octets [4]uint8) []byte {
+	for i, octet := range octets {
+		if i != 0 {
+			buf = append(buf, '.')
+		}
+		buf = strconv.AppendUint(buf, uint64(octet), 10)
+	}
+
+	return buf
 }
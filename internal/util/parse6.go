@@ -0,0 +1,19 @@
+package util
+
+import (
+	"errors"
+	"net/netip"
+)
+
+var ErrIpv6Syntax = errors.New("invalid IPv6 syntax")
+
+// ParseIpv6Bytes accepts any IPv6 form net/netip does, zones are dropped.
+// IPv4-mapped addresses are unmapped, so the result may be an IPv4 address.
+func ParseIpv6Bytes(ip []byte) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(string(ip))
+	if err != nil || !addr.Is6() {
+		return netip.Addr{}, &ParseError{Ip: string(ip), Err: ErrIpv6Syntax}
+	}
+
+	return addr.WithZone("").Unmap(), nil
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestParseIpv6Bytes(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string // empty if invalid
+	}{
+		{"::", "::"},
+		{"::1", "::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"2001:0DB8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"::ffff:1.2.3.4", "1.2.3.4"},
+		{"::ffff:102:304", "1.2.3.4"},
+		{"::1.2.3.4", "::102:304"},
+		{"1.2.3.4", ""},
+		{"", ""},
+		{":", ""},
+		{"1:2:3:4:5:6:7:8:9", ""},
+		{"2001:db8::1::2", ""},
+		{"2001:db8::g", ""},
+		{"[::1]", ""},
+		{" ::1", ""},
+		{"::ffff:1.2.3.256", ""},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseIpv6Bytes([]byte(tc.ip))
+		if tc.want == "" {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Err != ErrIpv6Syntax || parseErr.Ip != tc.ip {
+				t.Errorf("%q: got %v, %v, want a syntax error", tc.ip, got, err)
+			}
+			continue
+		}
+
+		if err != nil || got != netip.MustParseAddr(tc.want) {
+			t.Errorf("%q: got %v, %v, want %s", tc.ip, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseOctets(t *testing.T) {
+	tests := []struct {
+		ip        string
+		want      [4]uint8
+		err       error // nil if valid in both modes
+		canonical error // error in canonical mode if it differs from err
+	}{
+		{ip: "1.2.3.4", want: [4]uint8{1, 2, 3, 4}},
+		{ip: "0.0.0.0", want: [4]uint8{0, 0, 0, 0}},
+		{ip: "255.255.255.255", want: [4]uint8{255, 255, 255, 255}},
+		{ip: "01.2.3.4", want: [4]uint8{1, 2, 3, 4}, canonical: ErrSyntax},
+		{ip: "1.2.3.004", want: [4]uint8{1, 2, 3, 4}, canonical: ErrSyntax},
+		{ip: "1.2.3.256", err: ErrOctetRange},
+		{ip: "300.2.3.4", err: ErrOctetRange},
+		{ip: "1.2.3.99999999999999999999", err: ErrOctetRange},
+		{ip: "1..3.4", err: ErrSyntax},
+		{ip: "1.2.3.", err: ErrSyntax},
+		{ip: "", err: ErrSyntax},
+		{ip: "1.2.3", err: ErrOctetCount},
+		{ip: "1.2.3.4.5", err: ErrOctetCount},
+		{ip: " 1.2.3.4", err: ErrSyntax},
+		{ip: "1.2.3.4 ", err: ErrSyntax},
+		{ip: "+1.2.3.4", err: ErrSyntax},
+		{ip: "1.2.-3.4", err: ErrSyntax},
+		{ip: "1.2.3.a", err: ErrSyntax},
+	}
+
+	for _, tc := range tests {
+		for _, canonical := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%q/canonical=%t", tc.ip, canonical), func(t *testing.T) {
+				wantErr := tc.err
+				if canonical && tc.canonical != nil {
+					wantErr = tc.canonical
+				}
+
+				parsers := map[string]func(string) ([4]uint8, error){
+					"string": ParseToOctets,
+					"bytes":  func(ip string) ([4]uint8, error) { return ParseOctetsBytes([]byte(ip)) },
+				}
+				if canonical {
+					parsers = map[string]func(string) ([4]uint8, error){
+						"string": ParseToOctetsCanonical,
+						"bytes":  func(ip string) ([4]uint8, error) { return ParseOctetsBytesCanonical([]byte(ip)) },
+					}
+				}
+
+				for name, parse := range parsers {
+					got, err := parse(tc.ip)
+					if wantErr == nil {
+						if err != nil || got != tc.want {
+							t.Errorf("%s: got %v, %v, want %v", name, got, err, tc.want)
+						}
+						continue
+					}
+
+					var parseErr *ParseError
+					if !errors.Is(err, wantErr) || !errors.As(err, &parseErr) {
+						t.Errorf("%s: got error %v, want %v", name, err, wantErr)
+					}
+				}
+			})
+		}
+	}
+}
+
+// parseSplitAtoi is the parser fanout used before ParseOctetsBytes
+func parseSplitAtoi(ip string) ([4]uint8, error) {
+	strOctets := strings.Split(ip, ".")
+	if len(strOctets) != 4 {
+		return [4]uint8{}, fmt.Errorf("Invalid IP %s", ip)
+	}
+
+	result := [4]uint8{}
+	for i := 0; i < 4; i++ {
+		number, err := strconv.Atoi(strOctets[i])
+		if err != nil || number < 0 || number > 255 {
+			return [4]uint8{}, fmt.Errorf("Invalid octet '%s'", strOctets[i])
+		}
+		result[i] = uint8(number)
+	}
+
+	return result, nil
+}
+
+func BenchmarkParseOctets(b *testing.B) {
+	lines := make([][]byte, 1024)
+	for i := range lines {
+		lines[i] = []byte(fmt.Sprintf("%d.%d.%d.%d", i*7%256, i*13%256, i*31%256, i%256))
+	}
+
+	b.Run("split_atoi", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			// lines were converted to strings by bufio.Scanner.Text before
+			if _, err := parseSplitAtoi(string(lines[i%len(lines)])); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseOctetsBytes(lines[i%len(lines)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
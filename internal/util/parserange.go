@@ -0,0 +1,54 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrPrefixLength = errors.New("prefix length must be from 0 to 32")
+	ErrRangeOrder   = errors.New("range start is after its end")
+	ErrRangeSize    = errors.New("range is too large for this storage")
+)
+
+// ParseRangeBytes accepts CIDR "10.0.0.0/8" and dash range "1.2.3.4-1.2.3.200",
+// both ends are included. Addresses are parsed with parse, host bits of CIDR
+// are dropped, so "10.1.2.3/8" is the same as "10.0.0.0/8".
+func ParseRangeBytes(line []byte, parse func([]byte) ([4]uint8, error)) (first [4]uint8, last [4]uint8, err error) {
+	if slash := bytes.IndexByte(line, '/'); slash != -1 {
+		addr, err := parse(line[:slash])
+		if err != nil {
+			return first, last, err
+		}
+
+		prefix, err := strconv.ParseUint(string(line[slash+1:]), 10, 8)
+		if err != nil || prefix > 32 || len(line) > slash+3 {
+			return first, last, &ParseError{Ip: string(line), Err: ErrPrefixLength}
+		}
+
+		hostMask := uint32(1<<(32-prefix) - 1)
+		start := binary.BigEndian.Uint32(addr[:]) &^ hostMask
+		binary.BigEndian.PutUint32(first[:], start)
+		binary.BigEndian.PutUint32(last[:], start|hostMask)
+
+		return first, last, nil
+	}
+
+	dash := bytes.IndexByte(line, '-')
+	if dash == -1 {
+		return first, last, &ParseError{Ip: string(line), Err: ErrSyntax}
+	}
+	if first, err = parse(line[:dash]); err != nil {
+		return first, last, err
+	}
+	if last, err = parse(line[dash+1:]); err != nil {
+		return first, last, err
+	}
+	if binary.BigEndian.Uint32(first[:]) > binary.BigEndian.Uint32(last[:]) {
+		return first, last, &ParseError{Ip: string(line), Err: ErrRangeOrder}
+	}
+
+	return first, last, nil
+}
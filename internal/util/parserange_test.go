@@ -0,0 +1,59 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRangeBytes(t *testing.T) {
+	tests := []struct {
+		line  string
+		first [4]uint8
+		last  [4]uint8
+		err   error
+	}{
+		{line: "10.0.0.0/8", first: [4]uint8{10, 0, 0, 0}, last: [4]uint8{10, 255, 255, 255}},
+		{line: "10.1.2.3/8", first: [4]uint8{10, 0, 0, 0}, last: [4]uint8{10, 255, 255, 255}},
+		{line: "192.168.1.77/24", first: [4]uint8{192, 168, 1, 0}, last: [4]uint8{192, 168, 1, 255}},
+		{line: "1.2.3.4/32", first: [4]uint8{1, 2, 3, 4}, last: [4]uint8{1, 2, 3, 4}},
+		{line: "1.2.3.5/31", first: [4]uint8{1, 2, 3, 4}, last: [4]uint8{1, 2, 3, 5}},
+		{line: "1.2.3.4/0", first: [4]uint8{0, 0, 0, 0}, last: [4]uint8{255, 255, 255, 255}},
+		{line: "1.2.3.4-1.2.3.200", first: [4]uint8{1, 2, 3, 4}, last: [4]uint8{1, 2, 3, 200}},
+		{line: "10.0.0.5-10.0.1.3", first: [4]uint8{10, 0, 0, 5}, last: [4]uint8{10, 0, 1, 3}},
+		{line: "1.2.3.4-1.2.3.4", first: [4]uint8{1, 2, 3, 4}, last: [4]uint8{1, 2, 3, 4}},
+		{line: "1.2.3.4/33", err: ErrPrefixLength},
+		{line: "1.2.3.4/320", err: ErrPrefixLength},
+		{line: "1.2.3.4/08", first: [4]uint8{1, 0, 0, 0}, last: [4]uint8{1, 255, 255, 255}},
+		{line: "1.2.3.4/008", err: ErrPrefixLength},
+		{line: "1.2.3.4/", err: ErrPrefixLength},
+		{line: "1.2.3.4/-1", err: ErrPrefixLength},
+		{line: "1.2.3.4/+8", err: ErrPrefixLength},
+		{line: "1.2.3.4/a", err: ErrPrefixLength},
+		{line: "1.2.3.4/8/8", err: ErrPrefixLength},
+		{line: "1.2.3.200-1.2.3.4", err: ErrRangeOrder},
+		{line: "1.2.4.0-1.2.3.255", err: ErrRangeOrder},
+		{line: "1.2.3/8", err: ErrOctetCount},
+		{line: "1.2.3.256/8", err: ErrOctetRange},
+		{line: "1.2.3.4-", err: ErrSyntax},
+		{line: "-1.2.3.4", err: ErrSyntax},
+		{line: "1.2.3.4-1.2.3", err: ErrOctetCount},
+		{line: "1.2.3.4 - 1.2.3.5", err: ErrSyntax},
+		{line: "1.2.3.4-1.2.3.5-1.2.3.6", err: ErrSyntax},
+		{line: "1.2.3.4", err: ErrSyntax},
+	}
+
+	for _, tc := range tests {
+		first, last, err := ParseRangeBytes([]byte(tc.line), ParseOctetsBytes)
+		if tc.err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Err != tc.err {
+				t.Errorf("%q: got %v, want %v", tc.line, err, tc.err)
+			}
+			continue
+		}
+
+		if err != nil || first != tc.first || last != tc.last {
+			t.Errorf("%q: got %v-%v (%v), want %v-%v", tc.line, first, last, err, tc.first, tc.last)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package uniqip
+
+import (
+	"sync"
+
+	"github.com/Veckatimest/uniqipgo/internal/hll"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// Approx estimates the count with HyperLogLog++ sketch of 2^precision bytes
+// at most, see RelativeError. Safe for concurrent use.
+type Approx struct {
+	mu     sync.Mutex
+	sketch *hll.Sketch
+}
+
+// NewApprox accepts precision from 4 to 18, 14 gives 0.81% standard error in 16 KiB
+func NewApprox(precision uint8) (*Approx, error) {
+	sketch, err := hll.New(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Approx{sketch: sketch}, nil
+}
+
+func (a *Approx) Add(ip [4]byte) {
+	a.mu.Lock()
+	a.sketch.Add(ip)
+	a.mu.Unlock()
+}
+
+func (a *Approx) AddString(ip string) error {
+	octets, err := util.ParseToOctets(ip)
+	if err != nil {
+		return err
+	}
+	a.Add(octets)
+
+	return nil
+}
+
+// Count returns an estimate
+func (a *Approx) Count() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.sketch.Estimate()
+}
+
+func (a *Approx) Reset() {
+	a.mu.Lock()
+	a.sketch.Reset()
+	a.mu.Unlock()
+}
+
+// RelativeError is the standard error of Count, 1.04/sqrt(2^precision)
+func (a *Approx) RelativeError() float64 {
+	return a.sketch.RelativeError()
+}
+
+// Merge adds addresses of other, both need the same precision
+func (a *Approx) Merge(other *Approx) error {
+	other.mu.Lock()
+	otherSketch, err := other.sketch.MarshalBinary()
+	other.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var sketch hll.Sketch
+	if err := sketch.UnmarshalBinary(otherSketch); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.sketch.Merge(&sketch)
+}
+
+func (a *Approx) MarshalBinary() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.sketch.MarshalBinary()
+}
+
+func (a *Approx) UnmarshalBinary(data []byte) error {
+	var sketch hll.Sketch
+	if err := sketch.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.sketch = &sketch
+	a.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package uniqip
+
+import "github.com/Veckatimest/uniqipgo/internal/arrofmap"
+
+// ArrayOfMaps keeps 256 maps guarded by their own mutexes.
+// Safe for concurrent use, except Reset.
+type ArrayOfMaps struct {
+	storage *arrofmap.MapStorage
+}
+
+func NewArrayOfMaps() *ArrayOfMaps {
+	return &ArrayOfMaps{storage: arrofmap.NewArrayOfMap()}
+}
+
+func (am *ArrayOfMaps) Add(ip [4]byte) {
+	am.storage.AddParsedIp(ip)
+}
+
+func (am *ArrayOfMaps) AddString(ip string) error {
+	_, err := am.storage.AddIp(ip)
+
+	return err
+}
+
+func (am *ArrayOfMaps) Count() uint64 {
+	return am.storage.Count()
+}
+
+func (am *ArrayOfMaps) Reset() {
+	am.storage = arrofmap.NewArrayOfMap()
+}
+
+func (am *ArrayOfMaps) Contains(ip [4]byte) bool {
+	return am.storage.Contains(ip)
+}
+
+func (am *ArrayOfMaps) ContainsMany(ips [][4]byte) []bool {
+	return am.storage.ContainsMany(ips)
+}
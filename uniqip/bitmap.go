@@ -0,0 +1,79 @@
+package uniqip
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/Veckatimest/uniqipgo/internal/bitmap"
+	"github.com/Veckatimest/uniqipgo/internal/snapshot"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// Bitmap keeps a bit for every IPv4 address, it always takes 512 MiB.
+// Safe for concurrent use, except Reset.
+type Bitmap struct {
+	storage *bitmap.Bitmap
+	count   atomic.Uint64
+}
+
+func NewBitmap() *Bitmap {
+	return &Bitmap{storage: bitmap.New()}
+}
+
+func (b *Bitmap) Add(ip [4]byte) {
+	b.count.Add(b.storage.Add(ip))
+}
+
+func (b *Bitmap) AddString(ip string) error {
+	octets, err := util.ParseToOctets(ip)
+	if err != nil {
+		return err
+	}
+	b.Add(octets)
+
+	return nil
+}
+
+func (b *Bitmap) Count() uint64 {
+	return b.count.Load()
+}
+
+func (b *Bitmap) Reset() {
+	b.storage.Reset()
+	b.count.Store(0)
+}
+
+func (b *Bitmap) Contains(ip [4]byte) bool {
+	return b.storage.Contains(ip)
+}
+
+func (b *Bitmap) ContainsMany(ips [][4]byte) []bool {
+	return b.storage.ContainsMany(ips)
+}
+
+// All returns an iterator over added addresses in ascending order
+func (b *Bitmap) All() func(yield func([4]byte) bool) {
+	return b.storage.All()
+}
+
+// Save writes added addresses in snapshot format, it must not run
+// concurrently with other methods, except Count
+func (b *Bitmap) Save(writer io.Writer) error {
+	_, err := snapshot.Write(writer, b.storage.Blocks())
+
+	return err
+}
+
+// Load adds addresses from a file written by Save of Bitmap or Tree,
+// it must not run concurrently with other methods, except Count
+func (b *Bitmap) Load(reader io.Reader) error {
+	added, err := snapshot.Read(reader, b.storage.OrBlockOptimistic)
+	b.count.Add(added)
+
+	return err
+}
+
+// Merge adds addresses of other, neither bitmap may be used concurrently
+func (b *Bitmap) Merge(other *Bitmap) {
+	b.count.Add(b.storage.Merge(other.storage))
+}
@@ -0,0 +1,47 @@
+// Package uniqip exposes strategies of this repo for counting unique IPv4 addresses.
+//
+// All strategies implement Counter, so callers can swap them without other changes.
+// Fanout is the fastest one, but it has to be closed after use.
+package uniqip
+
+import "github.com/Veckatimest/uniqipgo/internal/util"
+
+// Counter accumulates IPv4 addresses and reports the number of unique ones.
+type Counter interface {
+	// Add stores an already parsed address
+	Add(ip [4]byte)
+	// AddString parses ip in dotted form and stores it
+	AddString(ip string) error
+	// Count returns number of unique addresses added since creation or last Reset
+	Count() uint64
+	// Reset forgets all added addresses
+	Reset()
+}
+
+// Lookup is implemented by exact counters which can tell whether
+// an address was added: Tree, ArrayOfMaps and Bitmap
+type Lookup interface {
+	Contains(ip [4]byte) bool
+	// ContainsMany returns Contains result for every address
+	ContainsMany(ips [][4]byte) []bool
+}
+
+// ParseIp converts dotted IPv4 string to the form accepted by Counter.Add
+func ParseIp(ip string) ([4]byte, error) {
+	return util.ParseToOctets(ip)
+}
+
+var (
+	_ Counter = (*StringMap)(nil)
+	_ Counter = (*UintMap)(nil)
+	_ Counter = (*BytesMap)(nil)
+	_ Counter = (*Tree)(nil)
+	_ Counter = (*ArrayOfMaps)(nil)
+	_ Counter = (*Bitmap)(nil)
+	_ Counter = (*Fanout)(nil)
+	_ Counter = (*Approx)(nil)
+
+	_ Lookup = (*Tree)(nil)
+	_ Lookup = (*ArrayOfMaps)(nil)
+	_ Lookup = (*Bitmap)(nil)
+)
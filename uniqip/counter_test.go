@@ -0,0 +1,206 @@
+package uniqip
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestCountersAgree(t *testing.T) {
+	valid := []string{
+		"1.2.3.4",
+		"01.2.3.4", // the same address with a leading zero
+		"1.2.3.4",
+		"10.0.0.1",
+		"255.255.255.255",
+		"0.0.0.0",
+		"192.168.1.1",
+		"192.168.1.2",
+	}
+	invalid := []string{"garbage", "1.2.3", "1.2.3.256", ""}
+	parsed := [][4]byte{{10, 0, 0, 1}, {10, 0, 0, 2}}
+	const want = 7
+
+	counters := []struct {
+		name string
+		new  func() Counter
+	}{
+		{"StringMap", func() Counter { return NewStringMap() }},
+		{"UintMap", func() Counter { return NewUintMap() }},
+		{"BytesMap", func() Counter { return NewBytesMap() }},
+		{"Tree", func() Counter { return NewTree(0) }},
+		{"ArrayOfMaps", func() Counter { return NewArrayOfMaps() }},
+		{"Bitmap", func() Counter { return NewBitmap() }},
+		{"Fanout", func() Counter { return NewFanout(2) }},
+	}
+
+	for _, tc := range counters {
+		t.Run(tc.name, func(t *testing.T) {
+			counter := tc.new()
+			if fanout, ok := counter.(*Fanout); ok {
+				defer fanout.Close()
+			}
+
+			for _, ip := range valid {
+				if err := counter.AddString(ip); err != nil {
+					t.Fatalf("AddString(%q) = %v", ip, err)
+				}
+			}
+			for _, ip := range invalid {
+				if err := counter.AddString(ip); err == nil {
+					t.Errorf("AddString(%q) accepted a malformed address", ip)
+				}
+			}
+			for _, ip := range parsed {
+				counter.Add(ip)
+			}
+
+			if got := counter.Count(); got != want {
+				t.Errorf("Count() = %d, want %d", got, want)
+			}
+
+			counter.Reset()
+			if got := counter.Count(); got != 0 {
+				t.Errorf("Count() after Reset = %d, want 0", got)
+			}
+		})
+	}
+}
+
+type lookupCounter interface {
+	Counter
+	Lookup
+}
+
+func lookupCounters() []struct {
+	name string
+	new  func() lookupCounter
+} {
+	return []struct {
+		name string
+		new  func() lookupCounter
+	}{
+		{"Tree", func() lookupCounter { return NewTree(0) }},
+		{"ArrayOfMaps", func() lookupCounter { return NewArrayOfMaps() }},
+		{"Bitmap", func() lookupCounter { return NewBitmap() }},
+	}
+}
+
+// randomIps returns count addresses, half of them from 10.0.0.0/16,
+// so some /24 networks are dense and others have a single address
+func randomIps(seed uint64, count int) [][4]byte {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	ips := make([][4]byte, count)
+	for i := range ips {
+		n := rng.Uint32()
+		if i%2 == 0 {
+			n = 10<<24 | n&0xFFFF
+		}
+		ips[i] = [4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+
+	return ips
+}
+
+func TestLookupsAgree(t *testing.T) {
+	added := randomIps(1, 20000)
+	queries := append(randomIps(2, 20000), added[:1000]...)
+	queries = append(queries, [4]byte{0, 0, 0, 0}, [4]byte{255, 255, 255, 255})
+
+	reference := map[[4]byte]bool{}
+	for _, ip := range added {
+		reference[ip] = true
+	}
+
+	for _, tc := range lookupCounters() {
+		counter := tc.new()
+		for _, ip := range added {
+			counter.Add(ip)
+		}
+
+		found := counter.ContainsMany(queries)
+		if len(found) != len(queries) {
+			t.Fatalf("%s: ContainsMany returned %d results for %d addresses", tc.name, len(found), len(queries))
+		}
+		for i, ip := range queries {
+			if got := counter.Contains(ip); got != reference[ip] || found[i] != reference[ip] {
+				t.Errorf("%s: %v: Contains = %t, ContainsMany = %t, want %t", tc.name, ip, got, found[i], reference[ip])
+			}
+		}
+	}
+}
+
+func TestAllAscending(t *testing.T) {
+	added := append(randomIps(3, 20000), [4]byte{0, 0, 0, 0}, [4]byte{255, 255, 255, 255}, [4]byte{10, 0, 0, 63}, [4]byte{10, 0, 0, 64})
+	want := slices.Clone(added)
+	slices.SortFunc(want, func(a, b [4]byte) int { return slices.Compare(a[:], b[:]) })
+	want = slices.Compact(want)
+
+	type iterable interface {
+		Counter
+		All() func(yield func([4]byte) bool)
+	}
+	iterables := []struct {
+		name string
+		new  func() iterable
+	}{
+		{"Tree", func() iterable { return NewTree(0) }},
+		{"Bitmap", func() iterable { return NewBitmap() }},
+	}
+
+	for _, tc := range iterables {
+		counter := tc.new()
+		for _, ip := range added {
+			counter.Add(ip)
+		}
+		all := counter.All()
+
+		var got [][4]byte
+		all(func(ip [4]byte) bool {
+			got = append(got, ip)
+			return true
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: All yields %d addresses, want %d in ascending order", tc.name, len(got), len(want))
+		}
+
+		// stops as soon as yield returns false
+		var yielded int
+		all(func(ip [4]byte) bool {
+			yielded++
+			return yielded < 3
+		})
+		if yielded != 3 {
+			t.Errorf("%s: All yields %d addresses after stop at 3", tc.name, yielded)
+		}
+	}
+}
+
+func TestTreeMergeReset(t *testing.T) {
+	target, other := NewTree(1), NewTree(1)
+	target.Add([4]byte{10, 0, 0, 1})
+	other.Add([4]byte{10, 0, 0, 2})
+	other.Add([4]byte{10, 0, 1, 1})
+	other.Add([4]byte{11, 0, 0, 1})
+
+	target.Merge(other)
+	if target.Count() != 4 {
+		t.Fatalf("Count() = %d after Merge, want 4", target.Count())
+	}
+
+	// a reset tree gets a new root, so it doesn't share blocks moved by Merge
+	other.Reset()
+	other.Add([4]byte{10, 0, 1, 2})
+	other.Add([4]byte{11, 0, 0, 2})
+	if target.Contains([4]byte{10, 0, 1, 2}) || target.Contains([4]byte{11, 0, 0, 2}) {
+		t.Errorf("adds to the reset other tree reached the merged one")
+	}
+	if !target.Contains([4]byte{10, 0, 1, 1}) || !target.Contains([4]byte{11, 0, 0, 1}) || target.Count() != 4 {
+		t.Errorf("Reset of the other tree changed the merged one")
+	}
+
+	target.Reset()
+	if other.Count() != 2 || !other.Contains([4]byte{10, 0, 1, 2}) {
+		t.Errorf("Reset of the merged tree changed the other one")
+	}
+}
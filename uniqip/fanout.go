@@ -0,0 +1,80 @@
+package uniqip
+
+import (
+	"context"
+	"io"
+	"runtime"
+
+	"github.com/Veckatimest/uniqipgo/internal/fanout"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// Fanout splits addresses between counter goroutines, so no locks are needed.
+// Add and AddString must not be called concurrently. Close stops the goroutines.
+type Fanout struct {
+	counter *fanout.Counter
+}
+
+// NewFanout starts counterThreads goroutines, zero means one per CPU
+func NewFanout(counterThreads int) *Fanout {
+	if counterThreads <= 0 {
+		counterThreads = runtime.NumCPU()
+	}
+
+	return &Fanout{counter: fanout.NewCounter(counterThreads)}
+}
+
+func (f *Fanout) Add(ip [4]byte) {
+	f.counter.Add(ip)
+}
+
+func (f *Fanout) AddString(ip string) error {
+	octets, err := util.ParseToOctets(ip)
+	if err != nil {
+		return err
+	}
+	f.counter.Add(octets)
+
+	return nil
+}
+
+func (f *Fanout) Count() uint64 {
+	return f.counter.Count()
+}
+
+func (f *Fanout) Reset() {
+	f.counter.Reset()
+}
+
+func (f *Fanout) Close() {
+	f.counter.Close()
+}
+
+// Options tune thread counts and handling of malformed lines of the RunReader pipeline
+type Options = fanout.Options
+
+// Result has unique count and malformed lines collected by RunReader
+type Result = fanout.Result
+
+// ErrorPolicy tells RunReader what to do with malformed lines
+type ErrorPolicy = util.ErrorPolicy
+
+const (
+	ErrorPolicyFail    = util.ErrorPolicyFail
+	ErrorPolicySkip    = util.ErrorPolicySkip
+	ErrorPolicyCollect = util.ErrorPolicyCollect
+)
+
+// RunReader counts unique ips in a stream of lines using the whole fanout
+// pipeline: reading, parsing, dispatching and counting run in parallel.
+func RunReader(ctx context.Context, reader io.Reader, opts Options) (Result, error) {
+	return fanout.RunReader(ctx, reader, opts)
+}
+
+// Decompress detects gzip, zstd, bzip2 or xz by magic bytes and decompresses
+// the stream on the fly, so it can be passed to RunReader
+func Decompress(reader io.Reader) (io.ReadCloser, error) {
+	decompressed, _, err := util.Decompress(reader)
+
+	return decompressed, err
+}
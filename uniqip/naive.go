@@ -0,0 +1,95 @@
+package uniqip
+
+import (
+	"github.com/Veckatimest/uniqipgo/internal/naive"
+	"github.com/Veckatimest/uniqipgo/internal/util"
+)
+
+// StringMap stores addresses as strings formatted back from parsed octets,
+// so "01.2.3.4" and "1.2.3.4" are the same address.
+// Not safe for concurrent use.
+type StringMap struct {
+	storage map[string]bool
+}
+
+func NewStringMap() *StringMap {
+	return &StringMap{storage: make(map[string]bool)}
+}
+
+func (sm *StringMap) Add(ip [4]byte) {
+	naive.AddStringIp(sm.storage, util.FormatOctets(ip))
+}
+
+func (sm *StringMap) AddString(ip string) error {
+	octets, err := util.ParseToOctets(ip)
+	if err != nil {
+		return err
+	}
+	naive.AddStringIp(sm.storage, util.FormatOctets(octets))
+
+	return nil
+}
+
+func (sm *StringMap) Count() uint64 {
+	return uint64(len(sm.storage))
+}
+
+func (sm *StringMap) Reset() {
+	sm.storage = make(map[string]bool)
+}
+
+// UintMap stores addresses packed into uint32.
+// Not safe for concurrent use.
+type UintMap struct {
+	storage map[uint32]bool
+}
+
+func NewUintMap() *UintMap {
+	return &UintMap{storage: naive.NewMapOfUint()}
+}
+
+func (um *UintMap) Add(ip [4]byte) {
+	um.storage[util.OctetsToUint(ip)] = true
+}
+
+func (um *UintMap) AddString(ip string) error {
+	_, err := naive.AddUintIp(um.storage, ip)
+
+	return err
+}
+
+func (um *UintMap) Count() uint64 {
+	return uint64(len(um.storage))
+}
+
+func (um *UintMap) Reset() {
+	um.storage = naive.NewMapOfUint()
+}
+
+// BytesMap stores addresses as [4]byte keys.
+// Not safe for concurrent use.
+type BytesMap struct {
+	storage map[naive.IpBytes]bool
+}
+
+func NewBytesMap() *BytesMap {
+	return &BytesMap{storage: naive.NewMapOfBytes()}
+}
+
+func (bm *BytesMap) Add(ip [4]byte) {
+	bm.storage[ip] = true
+}
+
+func (bm *BytesMap) AddString(ip string) error {
+	_, err := naive.AddBytesIp(bm.storage, ip)
+
+	return err
+}
+
+func (bm *BytesMap) Count() uint64 {
+	return uint64(len(bm.storage))
+}
+
+func (bm *BytesMap) Reset() {
+	bm.storage = naive.NewMapOfBytes()
+}
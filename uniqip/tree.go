@@ -0,0 +1,88 @@
+package uniqip
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/Veckatimest/uniqipgo/internal/iptree"
+	"github.com/Veckatimest/uniqipgo/internal/snapshot"
+)
+
+// Tree keeps every octet as a level of a tree.
+// Safe for concurrent use, except Reset.
+type Tree struct {
+	threads int
+	root    *iptree.RootLevel
+	count   atomic.Uint64
+}
+
+// NewTree uses threads goroutines to preallocate upper levels of the tree,
+// one per CPU if threads <= 0
+func NewTree(threads int) *Tree {
+	return &Tree{
+		threads: threads,
+		root:    iptree.NewRoot(threads),
+	}
+}
+
+func (t *Tree) Add(ip [4]byte) {
+	t.count.Add(iptree.AddParsedIp(t.root, ip))
+}
+
+func (t *Tree) AddString(ip string) error {
+	added, err := iptree.AddIp(t.root, ip)
+	if err != nil {
+		return err
+	}
+	t.count.Add(added)
+
+	return nil
+}
+
+func (t *Tree) Count() uint64 {
+	return t.count.Load()
+}
+
+func (t *Tree) Reset() {
+	t.root = iptree.NewRoot(t.threads)
+	t.count.Store(0)
+}
+
+func (t *Tree) Contains(ip [4]byte) bool {
+	return iptree.Contains(t.root, ip)
+}
+
+func (t *Tree) ContainsMany(ips [][4]byte) []bool {
+	return iptree.ContainsMany(t.root, ips)
+}
+
+// All returns an iterator over added addresses in ascending order
+func (t *Tree) All() func(yield func([4]byte) bool) {
+	return iptree.All(t.root)
+}
+
+// Save writes added addresses in snapshot format, it must not run
+// concurrently with other methods, except Count
+func (t *Tree) Save(writer io.Writer) error {
+	_, err := snapshot.Write(writer, iptree.Blocks(t.root))
+
+	return err
+}
+
+// Load adds addresses from a file written by Save of Tree or Bitmap,
+// it must not run concurrently with other methods, except Count
+func (t *Tree) Load(reader io.Reader) error {
+	added, err := snapshot.Read(reader, func(network uint32, words [4]uint64) uint64 {
+		return iptree.OrBlockOptimistic(t.root, network, words)
+	})
+	t.count.Add(added)
+
+	return err
+}
+
+// Merge adds addresses of other, which must not be used afterwards except
+// for Reset, since its subtrees may be moved to t. Reset gives other a new
+// tree, so it can be filled again. Neither tree may be used concurrently.
+func (t *Tree) Merge(other *Tree) {
+	t.count.Add(iptree.Merge(t.root, other.root))
+}